@@ -6,6 +6,8 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/eapache/go-resiliency/semaphore"
 )
 
 // ErrBreakerOpen is the error returned from Run() when the function is not executed
@@ -22,6 +24,7 @@ const (
 type Breaker struct {
 	errorThreshold, successThreshold int
 	timeout                          time.Duration
+	probes                           *semaphore.Semaphore
 
 	lock              sync.Mutex
 	state             uint32
@@ -42,6 +45,23 @@ func New(errorThreshold, successThreshold int, timeout time.Duration) *Breaker {
 	}
 }
 
+// WithHalfOpenLimit limits how many calls may run at once while the breaker is
+// half-open, using a semaphore with that many tickets; further calls return
+// ErrBreakerOpen as if the breaker were still open. A limit of one admits only a
+// single trial request at a time, so that a recovering service is probed gently
+// rather than hit by every waiting caller at once. By default there is no limit,
+// and a limit of zero or less also means no limit, since otherwise no trial could
+// ever run and the breaker would stay half-open forever. It must be called before
+// the breaker is used.
+func (b *Breaker) WithHalfOpenLimit(probes int) *Breaker {
+	if probes <= 0 {
+		b.probes = nil
+		return b
+	}
+	b.probes = semaphore.New(probes, 0)
+	return b
+}
+
 // Run will either return ErrBreakerOpen immediately if the circuit-breaker is
 // already open, or it will run the given function and pass along its return
 // value. It is safe to call Run concurrently on the same Breaker.
@@ -51,6 +71,12 @@ func (b *Breaker) Run(work func() error) error {
 	if state == open {
 		return ErrBreakerOpen
 	}
+	if state == halfOpen && b.probes != nil {
+		if !b.probes.TryAcquire() {
+			return ErrBreakerOpen
+		}
+		defer b.probes.Release()
+	}
 
 	return b.doWork(state, work)
 }
@@ -66,6 +92,16 @@ func (b *Breaker) Go(work func() error) error {
 	if state == open {
 		return ErrBreakerOpen
 	}
+	if state == halfOpen && b.probes != nil {
+		if !b.probes.TryAcquire() {
+			return ErrBreakerOpen
+		}
+		go func() {
+			defer b.probes.Release()
+			b.doWork(state, work)
+		}()
+		return nil
+	}
 
 	// errcheck complains about ignoring the error return value, but
 	// that's on purpose; if you want an error from a goroutine you have to
@@ -174,6 +174,70 @@ func TestBreakerAsyncStateTransitions(t *testing.T) {
 	}
 }
 
+func TestBreakerHalfOpenLimit(t *testing.T) {
+	breaker := New(1, 2, 50*time.Millisecond).WithHalfOpenLimit(1)
+
+	if err := breaker.Run(returnsError); err != errSomeError {
+		t.Error(err)
+	}
+	// wait for it to half-close
+	time.Sleep(100 * time.Millisecond)
+
+	probing := make(chan struct{})
+	finish := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- breaker.Run(func() error {
+			close(probing)
+			<-finish
+			return nil
+		})
+	}()
+	<-probing
+
+	// only one trial may run at a time
+	if err := breaker.Run(returnsSuccess); err != ErrBreakerOpen {
+		t.Error(err)
+	}
+	if err := breaker.Go(returnsSuccess); err != ErrBreakerOpen {
+		t.Error(err)
+	}
+
+	close(finish)
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+	// the next trial is admitted, and closes the breaker
+	if err := breaker.Go(returnsSuccess); err != nil {
+		t.Error(err)
+	}
+	// just enough to yield the scheduler and let the goroutines work off
+	time.Sleep(1 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		if err := breaker.Run(returnsSuccess); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestBreakerHalfOpenLimitZero(t *testing.T) {
+	breaker := New(1, 1, 50*time.Millisecond).WithHalfOpenLimit(0)
+
+	if err := breaker.Run(returnsError); err != errSomeError {
+		t.Error(err)
+	}
+	// wait for it to half-close
+	time.Sleep(100 * time.Millisecond)
+
+	// no limit means trials still run, and can close the breaker
+	if err := breaker.Run(returnsSuccess); err != nil {
+		t.Error(err)
+	}
+	if err := breaker.Run(returnsError); err != errSomeError {
+		t.Error("breaker should be closed again, got", err)
+	}
+}
+
 func ExampleBreaker() {
 	breaker := New(3, 1, 5*time.Second)
 
@@ -0,0 +1,32 @@
+// Package chain composes the resiliency patterns of this library for Go.
+package chain
+
+// Runner is implemented by every resiliency pattern that guards a single
+// func() error, including *breaker.Breaker, *retrier.Retrier and
+// *semaphore.Semaphore.
+type Runner interface {
+	Run(work func() error) error
+}
+
+type runners []Runner
+
+// Chain returns a Runner that runs work through each of the given runners in
+// turn, from left to right, so that the first runner is the outermost. For
+// example Chain(b, sem, r).Run(work) first checks the breaker, then acquires a
+// ticket from the semaphore, then runs work with retries, without nesting
+// closures by hand. Whatever error a runner returns, including one it passes
+// along from further down the chain, is returned by the runners before it as
+// usual. An empty chain just runs work.
+func Chain(rs ...Runner) Runner {
+	return runners(rs)
+}
+
+// Run runs work through the chain of runners.
+func (rs runners) Run(work func() error) error {
+	if len(rs) == 0 {
+		return work()
+	}
+	return rs[0].Run(func() error {
+		return rs[1:].Run(work)
+	})
+}
@@ -0,0 +1,83 @@
+package chain
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/eapache/go-resiliency/breaker"
+	"github.com/eapache/go-resiliency/retrier"
+	"github.com/eapache/go-resiliency/semaphore"
+)
+
+var errSomeError = errors.New("errSomeError")
+
+var (
+	_ Runner = (*breaker.Breaker)(nil)
+	_ Runner = (*retrier.Retrier)(nil)
+	_ Runner = (*semaphore.Semaphore)(nil)
+)
+
+type recorder struct {
+	name  string
+	calls *[]string
+}
+
+func (r recorder) Run(work func() error) error {
+	*r.calls = append(*r.calls, r.name)
+	return work()
+}
+
+func TestChainOrder(t *testing.T) {
+	var calls []string
+	runner := Chain(recorder{"a", &calls}, recorder{"b", &calls}, recorder{"c", &calls})
+
+	err := runner.Run(func() error {
+		calls = append(calls, "work")
+		return errSomeError
+	})
+	if err != errSomeError {
+		t.Error(err)
+	}
+	if expected := []string{"a", "b", "c", "work"}; !reflect.DeepEqual(calls, expected) {
+		t.Error("wrong order", calls)
+	}
+}
+
+func TestChainEmpty(t *testing.T) {
+	ran := false
+	if err := Chain().Run(func() error { ran = true; return nil }); err != nil || !ran {
+		t.Error(err, ran)
+	}
+}
+
+func TestChainPatterns(t *testing.T) {
+	b := breaker.New(1, 1, time.Second)
+	sem := semaphore.New(1, 0)
+	r := retrier.New(retrier.ConstantBackoff(2, time.Millisecond), nil)
+	runner := Chain(b, sem, r)
+
+	attempts := 0
+	err := runner.Run(func() error {
+		attempts++
+		if sem.Available() != 0 {
+			t.Error("work should run while holding a ticket")
+		}
+		return errSomeError
+	})
+	if err != errSomeError {
+		t.Error(err)
+	}
+	if attempts != 3 {
+		t.Error("expected the retrier to retry twice, got", attempts)
+	}
+	if !sem.IsEmpty() {
+		t.Error("the ticket should be released")
+	}
+
+	// the failure opened the breaker, so nothing further down runs
+	if err := runner.Run(func() error { t.Error("should not run"); return nil }); err != breaker.ErrBreakerOpen {
+		t.Error(err)
+	}
+}
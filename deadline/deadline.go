@@ -22,11 +22,13 @@ func New(timeout time.Duration) *Deadline {
 }
 
 // Run runs the given function, passing it a stopper channel. If the deadline passes before
-// the function finishes executing, Run returns ErrTimeOut to the caller and closes the stopper
+// the function finishes executing, Run returns ErrTimedOut to the caller and closes the stopper
 // channel so that the work function can attempt to exit gracefully. It does not (and cannot)
 // simply kill the running function, so if it doesn't respect the stopper channel then it may
-// keep running after the deadline passes. If the function finishes before the deadline, then
-// the return value of the function is returned from Run.
+// keep running after the deadline passes. The goroutine running the function exits as soon as
+// the function returns, even if Run has already given up on it, so nothing is leaked provided
+// that the function eventually observes the stopper channel. If the function finishes before
+// the deadline, then the return value of the function is returned from Run.
 func (d *Deadline) Run(work func(<-chan struct{}) error) error {
 	result := make(chan error)
 	stopper := make(chan struct{})
@@ -3,9 +3,12 @@ package retrier
 
 import (
 	"context"
+	"errors"
 	"math/rand"
 	"sync"
 	"time"
+
+	"github.com/eapache/go-resiliency/semaphore"
 )
 
 // Retrier implements the "retriable" resiliency pattern, abstracting out the process of retrying a failed action
@@ -17,6 +20,7 @@ type Retrier struct {
 	jitter        float64
 	rand          *rand.Rand
 	randMu        sync.Mutex
+	sem           *semaphore.Semaphore
 }
 
 // New constructs a Retrier with the given backoff pattern and classifier. The length of the backoff pattern
@@ -43,6 +47,18 @@ func (r *Retrier) WithInfiniteRetry() *Retrier {
 	return r
 }
 
+// WithConcurrencyLimit makes the retrier hold a ticket from the given semaphore while each attempt runs, so
+// that retries from many callers don't amplify load on an already-saturated downstream. The ticket is acquired
+// as if by AcquireContext before every attempt and released as soon as the attempt returns; it is not held while
+// sleeping between attempts. If no ticket can be acquired for the first attempt then the acquisition error is
+// returned without running the work function at all. If none can be acquired for a retry then the retries are
+// abandoned and the error from the previous attempt is returned, unless the context is done, in which case the
+// context's error is returned as usual.
+func (r *Retrier) WithConcurrencyLimit(sem *semaphore.Semaphore) *Retrier {
+	r.sem = sem
+	return r
+}
+
 // Run executes the given work function by executing RunCtx without context.Context.
 func (r *Retrier) Run(work func() error) error {
 	return r.RunFn(context.Background(), func(c context.Context, r int) error {
@@ -70,8 +86,23 @@ func (r *Retrier) RunCtx(ctx context.Context, work func(ctx context.Context) err
 // the number of attempted retries.
 func (r *Retrier) RunFn(ctx context.Context, work func(ctx context.Context, retries int) error) error {
 	retries := 0
+	var ret error
 	for {
-		ret := work(ctx, retries)
+		if r.sem != nil {
+			if err := r.sem.AcquireContext(ctx); err != nil {
+				if retries == 0 || errors.Is(err, ctx.Err()) {
+					return err
+				}
+				// the downstream is saturated, so give up rather than add to it
+				return ret
+			}
+			ret = func() error {
+				defer r.sem.Release()
+				return work(ctx, retries)
+			}()
+		} else {
+			ret = work(ctx, retries)
+		}
 
 		switch r.class.Classify(ret) {
 		case Succeed, Fail:
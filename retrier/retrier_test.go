@@ -5,6 +5,8 @@ import (
 	"errors"
 	"testing"
 	"time"
+
+	"github.com/eapache/go-resiliency/semaphore"
 )
 
 var i int
@@ -222,6 +224,73 @@ func TestRetrierJitter(t *testing.T) {
 	}
 }
 
+func TestRetrierConcurrencyLimit(t *testing.T) {
+	sem := semaphore.New(1, 0)
+	r := New([]time.Duration{0, 0}, nil).WithConcurrencyLimit(sem)
+
+	attempts := 0
+	err := r.Run(func() error {
+		attempts++
+		if sem.InUse() != 1 {
+			t.Error("each attempt should hold a ticket")
+		}
+		return errFoo
+	})
+	if err != errFoo || attempts != 3 {
+		t.Error(err, attempts)
+	}
+	if !sem.IsEmpty() {
+		t.Error("tickets should be released after each attempt")
+	}
+
+	// the downstream is saturated before the first attempt
+	sem.Acquire()
+	attempts = 0
+	err = r.Run(func() error {
+		attempts++
+		return nil
+	})
+	if !errors.Is(err, semaphore.ErrNoTickets) || attempts != 0 {
+		t.Error(err, attempts)
+	}
+	sem.Release()
+
+	// the downstream becomes saturated after the first attempt
+	attempts = 0
+	err = r.Run(func() error {
+		attempts++
+		sem.Resize(0)
+		return errBar
+	})
+	if err != errBar || attempts != 1 {
+		t.Error("retries should be abandoned when saturated, got", err, attempts)
+	}
+}
+
+func TestRetrierConcurrencyLimitPanic(t *testing.T) {
+	sem := semaphore.New(1, 0)
+	r := New(nil, nil).WithConcurrencyLimit(sem)
+
+	func() {
+		defer func() {
+			if val := recover(); val != "foo" {
+				t.Error("incorrect panic", val)
+			}
+		}()
+		r.Run(func() error {
+			panic("foo")
+		})
+	}()
+
+	// the panicking attempt must not have kept its ticket
+	if !sem.IsEmpty() {
+		t.Error("ticket should be released when the work panics")
+	}
+	if err := r.Run(func() error { return nil }); err != nil {
+		t.Error(err)
+	}
+}
+
 func TestRetrierThreadSafety(t *testing.T) {
 	r := New([]time.Duration{0}, nil)
 	for i := 0; i < 2; i++ {
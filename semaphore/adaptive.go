@@ -0,0 +1,101 @@
+package semaphore
+
+import (
+	"sync"
+	"time"
+)
+
+// LimitPolicy decides the ticket-count of an AdaptiveSemaphore based on the
+// latencies observed by its users.
+type LimitPolicy interface {
+	// Limit returns the ticket-count the semaphore should have, given its
+	// current ticket-count and a newly observed latency.
+	Limit(current int, latency time.Duration) int
+}
+
+// AIMD is a LimitPolicy that behaves like TCP congestion control: every latency
+// at or below Threshold additively increases the ticket-count, and every latency
+// above it multiplicatively decreases the ticket-count, within the given bounds.
+type AIMD struct {
+	// Threshold is the latency above which the protected resource is
+	// considered to be struggling.
+	Threshold time.Duration
+	// Min and Max bound the ticket-count. A Min of zero is treated as one,
+	// and a Max of zero means there is no upper bound.
+	Min, Max int
+	// Increase is how many tickets are added for each healthy latency. Zero
+	// is treated as one.
+	Increase int
+	// Decrease is the factor by which the ticket-count is multiplied for each
+	// unhealthy latency. Zero is treated as one half.
+	Decrease float64
+}
+
+// Limit implements LimitPolicy.
+func (p AIMD) Limit(current int, latency time.Duration) int {
+	min := p.Min
+	if min < 1 {
+		min = 1
+	}
+
+	var limit int
+	if latency <= p.Threshold {
+		increase := p.Increase
+		if increase == 0 {
+			increase = 1
+		}
+		limit = current + increase
+	} else {
+		decrease := p.Decrease
+		if decrease == 0 {
+			decrease = 0.5
+		}
+		limit = int(float64(current) * decrease)
+		if limit >= current {
+			// always make some progress, however small the factor
+			limit = current - 1
+		}
+	}
+
+	if p.Max > 0 && limit > p.Max {
+		limit = p.Max
+	}
+	if limit < min {
+		limit = min
+	}
+	return limit
+}
+
+// AdaptiveSemaphore is a Semaphore whose ticket-count is continually adjusted by
+// a LimitPolicy, based on the latencies reported to it with Observe. This lets
+// it shed load when a protected resource slows down, and admit more again once
+// it recovers. All the methods of Semaphore are available on it.
+type AdaptiveSemaphore struct {
+	*Semaphore
+
+	policy LimitPolicy
+	lock   sync.Mutex
+}
+
+// NewAdaptive constructs a new AdaptiveSemaphore with the given initial
+// ticket-count, timeout and policy.
+func NewAdaptive(tickets int, timeout time.Duration, policy LimitPolicy) *AdaptiveSemaphore {
+	return &AdaptiveSemaphore{
+		Semaphore: New(tickets, timeout),
+		policy:    policy,
+	}
+}
+
+// Observe reports a latency sample, such as how long a call to the protected
+// resource took, and resizes the semaphore as directed by its policy. As with
+// Resize, shrinking never revokes held tickets. It is safe to call Observe
+// concurrently on a single AdaptiveSemaphore; samples are applied one at a time.
+func (a *AdaptiveSemaphore) Observe(latency time.Duration) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	current := a.Cap()
+	if limit := a.policy.Limit(current, latency); limit != current && limit >= 0 {
+		a.Resize(limit)
+	}
+}
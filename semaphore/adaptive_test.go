@@ -0,0 +1,68 @@
+package semaphore
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAIMD(t *testing.T) {
+	policy := AIMD{Threshold: 10 * time.Millisecond, Min: 2, Max: 10}
+
+	tests := []struct {
+		current  int
+		latency  time.Duration
+		expected int
+	}{
+		{4, 5 * time.Millisecond, 5},
+		{4, 10 * time.Millisecond, 5},
+		{10, 5 * time.Millisecond, 10},
+		{8, 20 * time.Millisecond, 4},
+		{3, 20 * time.Millisecond, 2},
+		{2, 20 * time.Millisecond, 2},
+	}
+	for _, test := range tests {
+		if got := policy.Limit(test.current, test.latency); got != test.expected {
+			t.Errorf("Limit(%d, %v) = %d, expected %d", test.current, test.latency, got, test.expected)
+		}
+	}
+
+	policy = AIMD{Threshold: 10 * time.Millisecond, Increase: 3, Decrease: 0.9}
+	if got := policy.Limit(5, 0); got != 8 {
+		t.Error("wrong increase", got)
+	}
+	if got := policy.Limit(5, 1*time.Second); got != 4 {
+		t.Error("wrong decrease", got)
+	}
+	if got := policy.Limit(1, 1*time.Second); got != 1 {
+		t.Error("limit should never drop below one", got)
+	}
+}
+
+func TestAdaptiveSemaphore(t *testing.T) {
+	sem := NewAdaptive(4, 10*time.Millisecond, AIMD{Threshold: 100 * time.Millisecond, Max: 6})
+
+	sem.AcquireN(4)
+	if sem.TryAcquire() {
+		t.Error("semaphore should not have had a ticket")
+	}
+
+	sem.Observe(1 * time.Millisecond)
+	if sem.Cap() != 5 || !sem.TryAcquire() {
+		t.Error("healthy latency should have grown the semaphore", sem.Cap())
+	}
+
+	sem.Observe(1 * time.Second)
+	if sem.Cap() != 2 || sem.InUse() != 5 {
+		t.Error("unhealthy latency should have shrunk the semaphore", sem.Cap())
+	}
+
+	sem.ReleaseN(3)
+	if sem.TryAcquire() {
+		t.Error("shrunk semaphore should not have had a ticket")
+	}
+	sem.Release()
+	if !sem.TryAcquire() {
+		t.Error("semaphore should have had a ticket")
+	}
+	sem.ReleaseN(2)
+}
@@ -0,0 +1,118 @@
+package semaphore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// ErrBudgetExhausted is the error returned by AcquireWithRetry when it gives up
+// altogether, because every attempt timed out or the context's deadline passed.
+// Where ErrNoTickets means that a single attempt ran out of time, this means
+// that the caller's whole budget for acquiring a ticket has run out. The error
+// is returned wrapped, so check for it with errors.Is. It wraps ErrUnavailable.
+var ErrBudgetExhausted error = &unavailableError{"semaphore wait budget exhausted"}
+
+// budgetError is the error returned by AcquireWithRetry when it gives up.
+type budgetError struct {
+	attempts int
+	cause    error // the context's error, or nil if the attempts ran out
+}
+
+func (e *budgetError) Error() string {
+	if e.cause != nil {
+		return fmt.Sprintf("%v: %v", ErrBudgetExhausted, e.cause)
+	}
+	return fmt.Sprintf("%v after %d attempt(s)", ErrBudgetExhausted, e.attempts)
+}
+
+// Unwrap returns ErrBudgetExhausted.
+func (e *budgetError) Unwrap() error {
+	return ErrBudgetExhausted
+}
+
+// Is reports whether target is the context's error, so that a budget exhausted
+// by the context's deadline still matches context.DeadlineExceeded.
+func (e *budgetError) Is(target error) bool {
+	return e.cause != nil && target == e.cause
+}
+
+// Backoff decides how long AcquireWithRetry sleeps between attempts. Next is
+// called with the number of attempts made so far (starting at 1) and returns how
+// long to sleep before the next one. Implementations must be safe for
+// concurrent use if they are shared between callers.
+type Backoff interface {
+	Next(attempt int) time.Duration
+}
+
+// ExponentialJitter is a Backoff whose sleeps double with every attempt, from
+// Initial up to at most Max, with each sleep randomized to between half and all
+// of that amount so that competing callers spread out rather than retrying in
+// lockstep. A zero Initial defaults to 10ms, and a zero Max means no limit.
+type ExponentialJitter struct {
+	Initial time.Duration
+	Max     time.Duration
+}
+
+// Next implements Backoff.
+func (b ExponentialJitter) Next(attempt int) time.Duration {
+	d := b.Initial
+	if d <= 0 {
+		d = 10 * time.Millisecond
+	}
+	for i := 1; i < attempt && (b.Max <= 0 || d < b.Max) && d < time.Duration(1<<62); i++ {
+		d *= 2
+	}
+	if b.Max > 0 && d > b.Max {
+		d = b.Max
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
+
+// AcquireWithRetry tries to acquire a ticket like AcquireContext up to
+// maxAttempts times, sleeping for the duration given by backoff between attempts
+// that fail with ErrNoTickets. Compared to a single longer timeout, this gives
+// bursty contention time to subside while letting the caller's context be
+// checked between attempts; to consult other signals, such as the state of a
+// circuit breaker, cancel the context or wrap the Backoff. It returns nil once a
+// ticket is acquired, and any error other than ErrNoTickets immediately. If it
+// gives up because every attempt timed out, or because the context's deadline
+// passed, it returns an error wrapping ErrBudgetExhausted rather than
+// ErrNoTickets, so that giving up altogether can be told apart from a single
+// timeout; in the latter case the error also matches context.DeadlineExceeded.
+// If the context is cancelled it returns ctx.Err() as usual. A maxAttempts of
+// zero or less retries until the context is done, and a nil backoff uses a zero
+// ExponentialJitter. It is safe to call AcquireWithRetry concurrently on a
+// single Semaphore.
+func (s *Semaphore) AcquireWithRetry(ctx context.Context, maxAttempts int, backoff Backoff) error {
+	if backoff == nil {
+		backoff = ExponentialJitter{}
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := s.AcquireContext(ctx)
+		switch {
+		case err == context.DeadlineExceeded:
+			return &budgetError{attempts: attempt, cause: err}
+		case !errors.Is(err, ErrNoTickets):
+			return err
+		case attempt == maxAttempts:
+			return &budgetError{attempts: attempt}
+		}
+
+		t := s.newTimer(backoff.Next(attempt))
+		select {
+		case <-t.C:
+			t.Recycle()
+		case <-ctx.Done():
+			t.Stop()
+			if err := ctx.Err(); err != context.DeadlineExceeded {
+				return err
+			}
+			return &budgetError{attempts: attempt, cause: ctx.Err()}
+		}
+	}
+}
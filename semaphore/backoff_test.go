@@ -0,0 +1,85 @@
+package semaphore
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type countingBackoff struct {
+	calls int32
+	sleep time.Duration
+}
+
+func (b *countingBackoff) Next(attempt int) time.Duration {
+	atomic.AddInt32(&b.calls, 1)
+	return b.sleep
+}
+
+func TestExponentialJitter(t *testing.T) {
+	b := ExponentialJitter{Initial: 10 * time.Millisecond, Max: 50 * time.Millisecond}
+	for attempt, max := range []time.Duration{0, 10, 20, 40, 50, 50} {
+		if attempt == 0 {
+			continue
+		}
+		max *= time.Millisecond
+		for i := 0; i < 100; i++ {
+			if d := b.Next(attempt); d < max/2 || d > max {
+				t.Fatalf("attempt %d: %v not within [%v, %v]", attempt, d, max/2, max)
+			}
+		}
+	}
+
+	if d := (ExponentialJitter{}).Next(1000); d <= 0 {
+		t.Error("unbounded backoff should not overflow, got", d)
+	}
+}
+
+func TestSemaphoreAcquireWithRetry(t *testing.T) {
+	sem := New(1, 5*time.Millisecond)
+	sem.Acquire()
+
+	// every attempt fails
+	backoff := &countingBackoff{sleep: time.Millisecond}
+	err := sem.AcquireWithRetry(context.Background(), 3, backoff)
+	if !errors.Is(err, ErrBudgetExhausted) || !errors.Is(err, ErrUnavailable) || errors.Is(err, ErrNoTickets) {
+		t.Error(err)
+	}
+	if backoff.calls != 2 {
+		t.Error("expected 2 sleeps between 3 attempts, got", backoff.calls)
+	}
+
+	// a ticket frees up while backing off
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		sem.Release()
+	}()
+	if err := sem.AcquireWithRetry(context.Background(), 0, &countingBackoff{sleep: 10 * time.Millisecond}); err != nil {
+		t.Error(err)
+	}
+
+	// the context is cancelled while backing off
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err = sem.AcquireWithRetry(ctx, 0, &countingBackoff{sleep: time.Hour})
+	if !errors.Is(err, ErrBudgetExhausted) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Error(err)
+	}
+
+	// the context is cancelled outright
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if err := sem.AcquireWithRetry(ctx, 0, &countingBackoff{sleep: time.Hour}); err != context.Canceled {
+		t.Error(err)
+	}
+
+	// other errors are not retried
+	sem.Close()
+	backoff = &countingBackoff{}
+	if err := sem.AcquireWithRetry(context.Background(), 3, backoff); !errors.Is(err, ErrClosed) || backoff.calls != 0 {
+		t.Error(err, backoff.calls)
+	}
+	sem.Release()
+}
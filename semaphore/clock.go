@@ -0,0 +1,74 @@
+package semaphore
+
+import (
+	"sync"
+	"time"
+)
+
+// clock abstracts the creation of timers so that tests can control the passage
+// of time. NewTimer returns a channel that receives once the duration has
+// elapsed, and a stop function with the semantics of time.Timer.Stop.
+type clock interface {
+	NewTimer(d time.Duration) (<-chan time.Time, func() bool)
+}
+
+// withClock replaces the real clock used for timeouts, for tests.
+func withClock(c clock) Option {
+	return func(s *Semaphore) {
+		s.clock = c
+	}
+}
+
+// timers holds stopped and drained real timers for reuse, so that waiting for
+// a ticket does not allocate a new time.Timer every time.
+var timers sync.Pool
+
+// timer is a timer from either the real clock or a test clock. Timers from
+// the real clock are used directly so they cost no more than a time.Timer.
+type timer struct {
+	C    <-chan time.Time
+	real *time.Timer
+	stop func() bool
+}
+
+func (s *Semaphore) newTimer(d time.Duration) timer {
+	if s.clock == nil {
+		t, ok := timers.Get().(*time.Timer)
+		if ok {
+			t.Reset(d)
+		} else {
+			t = time.NewTimer(d)
+		}
+		return timer{C: t.C, real: t}
+	}
+	c, stop := s.clock.NewTimer(d)
+	return timer{C: c, stop: stop}
+}
+
+// Stop stops a timer that has not been received from. If it had already fired
+// then its channel is drained, so that it is safe to reset and reuse.
+func (t timer) Stop() {
+	var stopped bool
+	if t.real != nil {
+		stopped = t.real.Stop()
+	} else {
+		stopped = t.stop()
+	}
+	if !stopped {
+		// depending on the Go version and GODEBUG settings, a fired timer
+		// may or may not still have a value buffered in its channel
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+	t.Recycle()
+}
+
+// Recycle makes a timer which has been stopped, or has fired and been received
+// from, available for reuse. The timer must not be used afterwards.
+func (t timer) Recycle() {
+	if t.real != nil {
+		timers.Put(t.real)
+	}
+}
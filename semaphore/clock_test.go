@@ -0,0 +1,120 @@
+package semaphore
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock whose time only moves when Advance is called.
+type fakeClock struct {
+	lock    sync.Mutex
+	now     time.Duration
+	timers  []*fakeTimer
+	created chan struct{}
+}
+
+type fakeTimer struct {
+	deadline time.Duration
+	c        chan time.Time
+	done     bool
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{created: make(chan struct{}, 100)}
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) (<-chan time.Time, func() bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	t := &fakeTimer{deadline: c.now + d, c: make(chan time.Time, 1)}
+	c.timers = append(c.timers, t)
+	c.created <- struct{}{}
+
+	return t.c, func() bool {
+		c.lock.Lock()
+		defer c.lock.Unlock()
+
+		stopped := !t.done
+		t.done = true
+		return stopped
+	}
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.now += d
+	for _, t := range c.timers {
+		if !t.done && t.deadline <= c.now {
+			t.done = true
+			t.c <- time.Time{}
+		}
+	}
+}
+
+func TestSemaphoreTimeoutBoundary(t *testing.T) {
+	clock := newFakeClock()
+	sem := NewWithOptions(1, WithTimeout(100*time.Millisecond), withClock(clock))
+	sem.Acquire()
+
+	result := make(chan error)
+	go func() {
+		result <- sem.Acquire()
+	}()
+	<-clock.created
+
+	clock.Advance(99 * time.Millisecond)
+	select {
+	case err := <-result:
+		t.Fatal("acquire returned before the timeout:", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	clock.Advance(1 * time.Millisecond)
+	if err := <-result; !errors.Is(err, ErrNoTickets) {
+		t.Error(err)
+	}
+
+	// a ticket arriving before the deadline stops the timer
+	go func() {
+		result <- sem.Acquire()
+	}()
+	<-clock.created
+	clock.Advance(50 * time.Millisecond)
+	sem.Release()
+	if err := <-result; err != nil {
+		t.Error(err)
+	}
+	clock.Advance(1 * time.Hour)
+}
+
+func TestSemaphoreTimeoutBoundaryRace(t *testing.T) {
+	// When the ticket arrives and the deadline passes at the same moment, both
+	// cases of the wait are ready and select picks one at random. Whichever it
+	// picks, the waiter must end up with the ticket rather than reporting a
+	// spurious ErrNoTickets, and no ticket may be lost or duplicated.
+	for i := 0; i < 1000; i++ {
+		clock := newFakeClock()
+		sem := NewWithOptions(1, WithTimeout(100*time.Millisecond), withClock(clock))
+		sem.Acquire()
+
+		result := make(chan error)
+		go func() {
+			result <- sem.Acquire()
+		}()
+		<-clock.created
+
+		sem.Release()
+		clock.Advance(100 * time.Millisecond)
+		if err := <-result; err != nil {
+			t.Fatalf("iteration %d: %v", i, err)
+		}
+		if sem.InUse() != 1 || sem.TotalTimeouts() != 0 {
+			t.Fatalf("iteration %d: %d tickets held, %d timeouts", i, sem.InUse(), sem.TotalTimeouts())
+		}
+	}
+}
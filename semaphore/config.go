@@ -0,0 +1,76 @@
+package semaphore
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInvalidConfig is the error returned by NewFromConfig when the Config is not
+// valid. It is returned wrapped with a description of the problem, so check for
+// it with errors.Is.
+var ErrInvalidConfig = errors.New("invalid semaphore config")
+
+// Config holds the tunable parameters of a Semaphore in a form that can be
+// loaded from a configuration file, for use with NewFromConfig. The struct tags
+// cover both encoding/json and the common YAML packages. Timeout is a
+// time.Duration, so in JSON it is a number of nanoseconds.
+type Config struct {
+	// Name is the name of the semaphore, as set by WithName.
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// Tickets is the ticket-count, which must be positive.
+	Tickets int `json:"tickets" yaml:"tickets"`
+	// Timeout is how long to wait for a ticket, which must not be negative.
+	Timeout time.Duration `json:"timeout" yaml:"timeout"`
+	// MaxWaiters limits the number of waiting callers, as set by
+	// WithMaxWaiters. Zero means there is no limit.
+	MaxWaiters int `json:"maxWaiters,omitempty" yaml:"maxWaiters,omitempty"`
+	// Fair enables fairness, as set by WithFairness.
+	Fair bool `json:"fair,omitempty" yaml:"fair,omitempty"`
+}
+
+// NewFromConfig constructs a new Semaphore from the given Config, after checking
+// that it is valid. Further options may be given to configure anything the
+// Config does not cover, such as hooks.
+func NewFromConfig(config Config, opts ...Option) (*Semaphore, error) {
+	switch {
+	case config.Tickets <= 0:
+		return nil, fmt.Errorf("%w: tickets must be positive, got %d", ErrInvalidConfig, config.Tickets)
+	case config.Timeout < 0:
+		return nil, fmt.Errorf("%w: timeout must not be negative, got %v", ErrInvalidConfig, config.Timeout)
+	case config.MaxWaiters < 0:
+		return nil, fmt.Errorf("%w: maxWaiters must not be negative, got %d", ErrInvalidConfig, config.MaxWaiters)
+	}
+
+	configured := []Option{
+		WithName(config.Name),
+		WithTimeout(config.Timeout),
+		WithMaxWaiters(config.MaxWaiters),
+	}
+	if config.Fair {
+		configured = append(configured, WithFairness())
+	}
+	return NewWithOptions(config.Tickets, append(configured, opts...)...), nil
+}
+
+// NewChecked constructs a new Semaphore with the given ticket-count and timeout
+// like New, but first checks them, returning an error wrapping ErrInvalidConfig
+// if the ticket-count is not positive or the timeout is negative. It is
+// equivalent to calling NewFromConfig with just those two fields set.
+func NewChecked(tickets int, timeout time.Duration) (*Semaphore, error) {
+	return NewFromConfig(Config{Tickets: tickets, Timeout: timeout})
+}
+
+// Config returns the current configuration of the semaphore, reflecting any
+// changes made by Resize or SetTimeout since it was constructed, so that passing
+// it to NewFromConfig constructs an equivalent semaphore. It is safe to call
+// Config concurrently with all other methods on a single Semaphore.
+func (s *Semaphore) Config() Config {
+	return Config{
+		Name:       s.name,
+		Tickets:    s.Cap(),
+		Timeout:    s.Timeout(),
+		MaxWaiters: s.maxWaiters,
+		Fair:       s.fair,
+	}
+}
@@ -0,0 +1,59 @@
+package semaphore
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNewFromConfig(t *testing.T) {
+	var config Config
+	if err := json.Unmarshal([]byte(`{"name":"db","tickets":3,"timeout":1000000000,"maxWaiters":5,"fair":true}`), &config); err != nil {
+		t.Fatal(err)
+	}
+
+	sem, err := NewFromConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sem.Name() != "db" || sem.Cap() != 3 || sem.Timeout() != time.Second || sem.maxWaiters != 5 || !sem.fair {
+		t.Error("semaphore not configured as requested")
+	}
+	if sem.Config() != config {
+		t.Error("config should round-trip, got", sem.Config())
+	}
+
+	sem.Resize(4)
+	sem.SetTimeout(time.Minute)
+	encoded, _ := json.Marshal(sem.Config())
+	if string(encoded) != `{"name":"db","tickets":4,"timeout":60000000000,"maxWaiters":5,"fair":true}` {
+		t.Error(string(encoded))
+	}
+
+	for _, invalid := range []Config{
+		{Tickets: 0},
+		{Tickets: -1},
+		{Tickets: 1, Timeout: -time.Second},
+		{Tickets: 1, MaxWaiters: -1},
+	} {
+		if _, err := NewFromConfig(invalid); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%+v: expected ErrInvalidConfig, got %v", invalid, err)
+		}
+	}
+}
+
+func TestNewChecked(t *testing.T) {
+	sem, err := NewChecked(2, time.Second)
+	if err != nil || sem.Cap() != 2 || sem.Timeout() != time.Second {
+		t.Error(sem, err)
+	}
+	for _, tickets := range []int{0, -1} {
+		if _, err := NewChecked(tickets, time.Second); !errors.Is(err, ErrInvalidConfig) {
+			t.Error(tickets, err)
+		}
+	}
+	if _, err := NewChecked(1, -time.Second); !errors.Is(err, ErrInvalidConfig) {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,29 @@
+package semaphore
+
+import (
+	"expvar"
+	"fmt"
+	"sync"
+)
+
+// publishLock serializes PublishExpvar so that checking for an existing
+// variable and publishing a new one happen atomically.
+var publishLock sync.Mutex
+
+// PublishExpvar publishes the semaphore's Stats as an expvar variable with the
+// given name, so that they are served as JSON from /debug/vars alongside the
+// other standard-library metrics. The stats are read afresh every time the
+// variable is read. Unlike expvar.Publish, it returns an error instead of
+// panicking if a variable with that name has already been published.
+func (s *Semaphore) PublishExpvar(name string) error {
+	publishLock.Lock()
+	defer publishLock.Unlock()
+
+	if expvar.Get(name) != nil {
+		return fmt.Errorf("semaphore: expvar %q is already published", name)
+	}
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return s.Stats()
+	}))
+	return nil
+}
@@ -0,0 +1,36 @@
+package semaphore
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSemaphorePublishExpvar(t *testing.T) {
+	// expvar can't unpublish, so find a name unused by any earlier run
+	name := t.Name()
+	for i := 1; expvar.Get(name) != nil; i++ {
+		name = fmt.Sprintf("%s_%d", t.Name(), i)
+	}
+
+	sem := New(3, 1*time.Second)
+	if err := sem.PublishExpvar(name); err != nil {
+		t.Fatal(err)
+	}
+	if err := sem.PublishExpvar(name); err == nil {
+		t.Error("publishing the same name twice should fail")
+	}
+
+	sem.AcquireN(2)
+	defer sem.ReleaseN(2)
+
+	var stats Stats
+	if err := json.Unmarshal([]byte(expvar.Get(name).String()), &stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats != sem.Stats() {
+		t.Error("published stats don't match:", stats)
+	}
+}
@@ -0,0 +1,59 @@
+package semaphore
+
+import (
+	"context"
+	"sync"
+)
+
+// RunAll runs every task in its own goroutine, using the semaphore to bound how
+// many run at once: each task holds one ticket while it runs, and tasks wait for
+// as long as it takes to get one regardless of the semaphore's timeout. The tasks
+// are given a context derived from ctx which is cancelled as soon as any task
+// fails, once RunAll returns, or when ctx itself is done; no further tasks are
+// started after that. RunAll always waits for every task it started before
+// returning. It returns the first error encountered, which is either an error
+// returned by a task, ctx.Err() if the context was done before every task could
+// be started, or ErrClosed if the semaphore was closed. It is safe to call RunAll
+// concurrently on a single Semaphore, with the calls sharing its tickets.
+func (s *Semaphore) RunAll(ctx context.Context, tasks []func(context.Context) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	for _, task := range tasks {
+		if ctx.Err() != nil {
+			// a ticket may be free, but nothing more should be started
+			fail(ctx.Err())
+			break
+		}
+		if err := s.acquire(1, 0, -1, ctx.Done()); err != nil {
+			if err == errDone {
+				err = ctx.Err()
+			}
+			fail(err)
+			break
+		}
+
+		wg.Add(1)
+		go func(task func(context.Context) error) {
+			defer wg.Done()
+			defer s.Release()
+
+			if err := task(ctx); err != nil {
+				fail(err)
+			}
+		}(task)
+	}
+
+	wg.Wait()
+	return firstErr
+}
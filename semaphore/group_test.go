@@ -0,0 +1,90 @@
+package semaphore
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSemaphoreRunAll(t *testing.T) {
+	sem := New(2, 0)
+
+	var running, peak, finished int32
+	tasks := make([]func(context.Context) error, 10)
+	for i := range tasks {
+		tasks[i] = func(context.Context) error {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			atomic.AddInt32(&finished, 1)
+			return nil
+		}
+	}
+
+	if err := sem.RunAll(context.Background(), tasks); err != nil {
+		t.Error(err)
+	}
+	if finished != 10 {
+		t.Error("every task should have run, got", finished)
+	}
+	if peak > 2 {
+		t.Error("concurrency should be bounded by the ticket-count, got", peak)
+	}
+	if !sem.IsEmpty() {
+		t.Error("every ticket should have been released")
+	}
+}
+
+func TestSemaphoreRunAllError(t *testing.T) {
+	sem := New(2, 0)
+	errTask := errors.New("errTask")
+
+	var started, cancelled int32
+	slow := func(ctx context.Context) error {
+		atomic.AddInt32(&started, 1)
+		select {
+		case <-ctx.Done():
+			atomic.AddInt32(&cancelled, 1)
+			return ctx.Err()
+		case <-time.After(time.Second):
+			return nil
+		}
+	}
+	failing := func(context.Context) error {
+		atomic.AddInt32(&started, 1)
+		time.Sleep(5 * time.Millisecond)
+		return errTask
+	}
+
+	err := sem.RunAll(context.Background(), []func(context.Context) error{slow, failing, slow, slow})
+	if err != errTask {
+		t.Error(err)
+	}
+	if cancelled < 1 {
+		t.Error("running tasks should have been cancelled")
+	}
+	if started == 4 {
+		t.Error("tasks should not be started after a failure")
+	}
+	if !sem.IsEmpty() {
+		t.Error("every ticket should have been released")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	started = 0
+	if err := sem.RunAll(ctx, []func(context.Context) error{slow}); err != context.Canceled {
+		t.Error(err)
+	}
+	if started != 0 {
+		t.Error("no task should start with a cancelled context")
+	}
+}
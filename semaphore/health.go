@@ -0,0 +1,59 @@
+package semaphore
+
+import "time"
+
+// DefaultHealthGracePeriod is how long a semaphore may stay saturated before
+// Healthy reports it as unhealthy, unless set otherwise by
+// WithHealthGracePeriod.
+const DefaultHealthGracePeriod = 1 * time.Second
+
+// Healthy reports whether the semaphore is keeping up with demand, for use in a
+// readiness probe. It returns false once the semaphore has been continuously
+// saturated, meaning that every ticket is held and callers are queued waiting
+// for them, for longer than the grace period set by WithHealthGracePeriod.
+// Momentary saturation shorter than that does not count, so that brief spikes
+// don't make the probe flap. While the semaphore is shedding load (see
+// WithShedWhenUnhealthy) it is always unhealthy. It is safe to call Healthy
+// concurrently with all other methods on a single Semaphore.
+func (s *Semaphore) Healthy() bool {
+	return s.HealthyWithGrace(s.healthGrace)
+}
+
+// HealthyWithGrace is like Healthy, but with the given grace period instead of
+// the configured one. It is safe to call HealthyWithGrace concurrently with all
+// other methods on a single Semaphore.
+func (s *Semaphore) HealthyWithGrace(grace time.Duration) bool {
+	s.lock.Lock()
+	since, shedding := s.contendedSince, s.shedding
+	s.lock.Unlock()
+
+	return !shedding && (since.IsZero() || time.Since(since) <= grace)
+}
+
+// checkContention records when the semaphore becomes saturated with callers
+// waiting, and forgets it once that is no longer the case. It must be called
+// with the lock held.
+func (s *Semaphore) checkContention() {
+	held, tickets := s.loadHeld(), s.loadTickets()
+	contended := held >= tickets && s.waiters.Len() > 0
+	switch {
+	case contended && s.contendedSince.IsZero():
+		s.contendedSince = time.Now()
+	case !contended:
+		s.contendedSince = time.Time{}
+	}
+	if s.shedding && held < tickets {
+		s.shedding = false
+	}
+	s.updateSlow()
+}
+
+// shouldShed reports whether an acquisition that would have to wait should be
+// rejected instead, starting to shed load if the semaphore has been saturated
+// for longer than the grace period. It must be called with the lock held.
+func (s *Semaphore) shouldShed() bool {
+	if !s.shedding && !s.contendedSince.IsZero() {
+		s.shedding = time.Since(s.contendedSince) > s.healthGrace
+	}
+	return s.shedding
+}
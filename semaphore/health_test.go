@@ -0,0 +1,112 @@
+package semaphore
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSemaphoreHealthy(t *testing.T) {
+	sem := NewWithOptions(1, WithTimeout(time.Second), WithHealthGracePeriod(20*time.Millisecond))
+	if !sem.Healthy() {
+		t.Error("idle semaphore should be healthy")
+	}
+
+	sem.Acquire()
+	if !sem.Healthy() {
+		t.Error("saturation without waiters should be healthy")
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- sem.Acquire()
+	}()
+	for sem.WaitCount() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	if !sem.Healthy() {
+		t.Error("momentary saturation should be healthy")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if sem.Healthy() {
+		t.Error("sustained saturation should be unhealthy")
+	}
+	if !sem.HealthyWithGrace(time.Hour) {
+		t.Error("saturation within a longer grace period should be healthy")
+	}
+
+	// the ticket goes straight to the waiter, so the semaphore is still full
+	// but nobody is waiting any more
+	sem.Release()
+	<-done
+	if !sem.Healthy() {
+		t.Error("semaphore without waiters should be healthy again")
+	}
+	sem.Release()
+
+	if NewWithOptions(1).healthGrace != DefaultHealthGracePeriod {
+		t.Error("wrong default grace period")
+	}
+}
+
+func TestSemaphoreShedWhenUnhealthy(t *testing.T) {
+	sem := NewWithOptions(1, WithTimeout(time.Second), WithHealthGracePeriod(20*time.Millisecond), WithShedWhenUnhealthy())
+	sem.Acquire()
+
+	done := make(chan error)
+	go func() {
+		done <- sem.Acquire()
+	}()
+	for sem.WaitCount() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// momentary saturation still queues
+	go func() {
+		done <- sem.AcquireTimeout(5 * time.Millisecond)
+	}()
+	if err := <-done; !errors.Is(err, ErrNoTickets) {
+		t.Error(err)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	start := time.Now()
+	if err := sem.Acquire(); !errors.Is(err, ErrNoTickets) {
+		t.Error("sustained saturation should shed load, got", err)
+	}
+	if time.Since(start) > 100*time.Millisecond {
+		t.Error("shedding should be immediate")
+	}
+
+	// the queue drains but every ticket is still held, so keep shedding
+	sem.Release()
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+	if err := sem.Acquire(); !errors.Is(err, ErrNoTickets) {
+		t.Error("shedding should continue until a ticket is free, got", err)
+	}
+	if sem.Healthy() {
+		t.Error("semaphore should be unhealthy while shedding")
+	}
+	if counters := sem.CountersSnapshot(false); counters.Rejected != 2 || counters.TimedOut != 1 {
+		t.Errorf("shedding should count as rejected, got %+v", counters)
+	}
+
+	// a free ticket ends the shedding
+	sem.Release()
+	if !sem.Healthy() {
+		t.Error("semaphore should be healthy again")
+	}
+	if err := sem.Acquire(); err != nil {
+		t.Error(err)
+	}
+	start = time.Now()
+	if err := sem.AcquireTimeout(10 * time.Millisecond); !errors.Is(err, ErrNoTickets) {
+		t.Error(err)
+	}
+	if time.Since(start) < 10*time.Millisecond {
+		t.Error("acquisitions should queue again once recovered")
+	}
+	sem.Release()
+}
@@ -0,0 +1,70 @@
+package semaphore
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// WithInvariantChecks makes the semaphore verify its internal invariants as it
+// runs. Every time tickets are taken or returned, including on the lock-free
+// fast paths, it checks that the number held stays between zero and the
+// ticket-count; shrinking the semaphore may legitimately leave more tickets held
+// than its new ticket-count, so only acquisitions are held to the upper bound.
+// Every time it hands tickets to waiters it also checks that every queued waiter
+// is counted as waiting, and that no waiter is left queued while enough tickets
+// are free to serve it (in fair mode, only the waiter at the front of the queue
+// is held to this, since the rest are meant to wait their turn). A violation
+// panics with a description of the state that broke it.
+//
+// The checks are meant for tests, and are only compiled in with the
+// semaphore_invariants build tag, as in "go test -tags semaphore_invariants".
+// Without it the option has no effect and the checks cost nothing.
+func WithInvariantChecks() Option {
+	return func(s *Semaphore) {
+		s.invariants = true
+	}
+}
+
+// checkClaim verifies that taking n tickets left held of them held, out of a
+// ticket-count of tickets.
+func (s *Semaphore) checkClaim(n int, held, tickets int64) {
+	if n < 0 || held < 0 || held > tickets {
+		s.violated("acquiring %d ticket(s) left %d held out of %d", n, held, tickets)
+	}
+}
+
+// checkUnclaim verifies that returning n tickets left held of them held.
+func (s *Semaphore) checkUnclaim(n int, held int64) {
+	if n < 0 || held < 0 {
+		s.violated("releasing %d ticket(s) left %d held", n, held)
+	}
+}
+
+// checkWaiters verifies the invariants of WithInvariantChecks once
+// notifyWaiters is done. It must be called with the lock held.
+func (s *Semaphore) checkWaiters() {
+	if waiting := atomic.LoadInt64(&s.waiting); waiting < int64(s.waiters.Len()) {
+		s.violated("%d waiter(s) queued but only %d counted as waiting", s.waiters.Len(), waiting)
+	}
+
+	// tickets can only be freed without the lock by release, so unless one is
+	// in progress (and about to settle) the free tickets were all offered
+	free := s.loadTickets() - s.loadHeld()
+	for elem := s.waiters.Front(); elem != nil; elem = elem.Next() {
+		w := elem.Value.(*waiter)
+		if w.n <= free && atomic.LoadInt64(&s.releasing) == 0 {
+			s.violated("a waiter for %d ticket(s) was left queued with %d free", w.n, free)
+		}
+		if s.fair {
+			break
+		}
+	}
+}
+
+func (s *Semaphore) violated(format string, args ...interface{}) {
+	prefix := "semaphore: "
+	if s.name != "" {
+		prefix = namePrefix(s.name)
+	}
+	panic(prefix + "invariant violated: " + fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,163 @@
+//go:build go1.18
+// +build go1.18
+
+package semaphore
+
+import (
+	"runtime"
+	"testing"
+)
+
+// FuzzSemaphoreInvariants drives a semaphore through a sequence of operations
+// decoded from the input, checking its state against a model after every one.
+// Callers that have to wait are run in their own goroutines, but tickets are
+// only ever handed over with the lock held during an operation, so the same
+// input always produces the same states and failures can be replayed. Run with
+// the semaphore_invariants build tag, the semaphore also checks its internal
+// invariants as it goes.
+func FuzzSemaphoreInvariants(f *testing.F) {
+	f.Add(byte(0), []byte{0, 1, 2, 3, 4, 5, 6, 7})
+	f.Add(byte(1), []byte{4, 9, 14, 5, 1, 6, 11, 2, 0, 3})
+	f.Add(byte(6), []byte{8, 13, 3, 18, 1, 1, 0, 23, 7, 2, 28, 3})
+	f.Add(byte(7), []byte{5, 0, 0, 9, 14, 19, 1, 6, 11, 3, 3, 2, 12, 1})
+
+	f.Fuzz(fuzzSemaphoreInvariants)
+}
+
+// fuzzWaiter is a caller blocked in the semaphore, and the outcome it ended up
+// with once it is no longer waiting.
+type fuzzWaiter struct {
+	n      int
+	result chan error
+}
+
+func fuzzSemaphoreInvariants(t *testing.T, mode byte, ops []byte) {
+	if len(ops) > 256 {
+		ops = ops[:256]
+	}
+	fair := mode&1 != 0
+	opts := []Option{WithInvariantChecks()}
+	if fair {
+		opts = append(opts, WithFairness())
+	}
+	tickets := int(mode>>2)%4 + 1
+	sem := NewWithOptions(tickets, opts...)
+	if mode&2 != 0 {
+		// keeps the fast paths off for the whole run
+		sem.Notify()
+	}
+	// don't leave waiters blocked forever if the run fails early
+	defer sem.Close()
+
+	held, paused := 0, false
+	var waiters []*fuzzWaiter
+
+	// settle waits for every waiter that has left the queue to report its
+	// outcome, taking over the tickets of those that were served
+	settle := func() {
+		for {
+			queued := len(sem.DumpWaiters())
+			reported := 0
+			for _, w := range waiters {
+				if len(w.result) > 0 {
+					reported++
+				}
+			}
+			if queued+reported == len(waiters) && sem.WaitCount() == queued {
+				break
+			}
+			runtime.Gosched()
+		}
+		remaining := waiters[:0]
+		for _, w := range waiters {
+			select {
+			case err := <-w.result:
+				if err == nil {
+					held += w.n
+				}
+			default:
+				remaining = append(remaining, w)
+			}
+		}
+		waiters = remaining
+	}
+
+	for i, op := range ops {
+		arg := int(op / 5)
+		switch op % 5 {
+		case 0:
+			n := arg%3 + 1
+			ok := sem.TryAcquireN(n)
+			want := !paused && held+n <= tickets && (!fair || len(waiters) == 0)
+			if ok != want {
+				t.Fatalf("op %d: TryAcquireN(%d) = %v with %d of %d held", i, n, ok, held, tickets)
+			}
+			if ok {
+				held += n
+			}
+		case 1:
+			if held > 0 {
+				n := arg%held + 1
+				sem.ReleaseN(n)
+				held -= n
+			}
+		case 2:
+			tickets = arg % 5
+			if err := sem.Resize(tickets); err != nil {
+				t.Fatal(err)
+			}
+		case 3:
+			if paused {
+				sem.Resume()
+			} else {
+				sem.Pause()
+			}
+			paused = !paused
+		case 4:
+			w := &fuzzWaiter{n: arg%3 + 1, result: make(chan error, 1)}
+			waiters = append(waiters, w)
+			go func() {
+				w.result <- sem.acquire(w.n, 0, -1, nil)
+			}()
+		}
+		settle()
+
+		if sem.InUse() != held {
+			t.Fatalf("op %d: %d tickets in use, expected %d", i, sem.InUse(), held)
+		}
+		if sem.Cap() != tickets {
+			t.Fatalf("op %d: ticket-count %d, expected %d", i, sem.Cap(), tickets)
+		}
+		free := tickets - held
+		if free < 0 {
+			free = 0
+		}
+		if sem.Available() != free {
+			t.Fatalf("op %d: %d tickets available, expected %d", i, sem.Available(), free)
+		}
+		if sem.IsPaused() != paused {
+			t.Fatalf("op %d: paused is %v, expected %v", i, sem.IsPaused(), paused)
+		}
+		if paused && len(waiters) > 0 {
+			t.Fatalf("op %d: %d callers still waiting while paused", i, len(waiters))
+		}
+		for j, w := range sem.DumpWaiters() {
+			if w.Tickets <= free {
+				t.Fatalf("op %d: waiter for %d ticket(s) left queued with %d free", i, w.Tickets, free)
+			}
+			if fair && j == 0 {
+				break
+			}
+		}
+	}
+
+	sem.Close()
+	settle()
+	if len(waiters) != 0 {
+		t.Fatalf("%d callers still waiting after Close", len(waiters))
+	}
+	sem.ReleaseN(held)
+	if !sem.IsEmpty() || sem.WaitCount() != 0 {
+		t.Errorf("unbalanced after every release: %d in use, %d waiting", sem.InUse(), sem.WaitCount())
+	}
+}
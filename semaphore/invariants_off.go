@@ -0,0 +1,8 @@
+//go:build !semaphore_invariants
+// +build !semaphore_invariants
+
+package semaphore
+
+// invariantChecks disables the checks of WithInvariantChecks, so that the
+// compiler removes them.
+const invariantChecks = false
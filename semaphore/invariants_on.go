@@ -0,0 +1,7 @@
+//go:build semaphore_invariants
+// +build semaphore_invariants
+
+package semaphore
+
+// invariantChecks enables the checks of WithInvariantChecks.
+const invariantChecks = true
@@ -0,0 +1,146 @@
+package semaphore
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSemaphoreInvariantChecks(t *testing.T) {
+	sem := NewWithOptions(2, WithName("db"), WithTimeout(time.Second), WithInvariantChecks())
+
+	// shrinking below the number of tickets held is not a violation
+	if err := sem.AcquireN(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := sem.Resize(1); err != nil {
+		t.Fatal(err)
+	}
+	sem.ReleaseN(2)
+	if err := sem.Acquire(); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- sem.AcquireTimeout(50 * time.Millisecond)
+	}()
+	for sem.WaitCount() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	// uncount the queued waiter behind the semaphore's back
+	atomic.AddInt64(&sem.waiting, -1)
+
+	func() {
+		defer func() {
+			val := recover()
+			if !invariantChecks {
+				if val != nil {
+					t.Error("checks should be compiled out, got", val)
+				}
+				return
+			}
+			msg, _ := val.(string)
+			if !strings.Contains(msg, `semaphore "db": invariant violated: 1 waiter(s) queued but only 0 counted as waiting`) {
+				t.Error("wrong panic:", val)
+			}
+		}()
+		sem.Resize(1)
+	}()
+	atomic.AddInt64(&sem.waiting, 1)
+
+	if err := <-done; !errors.Is(err, ErrNoTickets) {
+		t.Error("waiter should have timed out, got", err)
+	}
+	sem.Release()
+}
+
+func TestSemaphoreInvariantChecksHeld(t *testing.T) {
+	sem := NewWithOptions(2, WithInvariantChecks())
+
+	for _, tc := range []struct {
+		name   string
+		change func() bool
+		panic  string
+	}{
+		{"claim", func() bool { return sem.claim(-1) }, "invariant violated: acquiring -1 ticket(s) left -1 held out of 2"},
+		{"unclaim", func() bool { return sem.unclaim(-1) }, "invariant violated: releasing -1 ticket(s) left 1 held"},
+	} {
+		func() {
+			defer func() {
+				val := recover()
+				if !invariantChecks {
+					if val != nil {
+						t.Error(tc.name, "checks should be compiled out, got", val)
+					}
+					return
+				}
+				msg, _ := val.(string)
+				if !strings.Contains(msg, tc.panic) {
+					t.Error(tc.name, "wrong panic:", val)
+				}
+			}()
+			// the lock-free paths are checked too, so no lock is taken here
+			tc.change()
+		}()
+		atomic.StoreInt64(&sem.held, 0)
+	}
+
+	// ordinary use, including shrinking below the tickets held, is fine
+	sem.AcquireN(2)
+	sem.Resize(1)
+	sem.ReleaseN(2)
+}
+
+func TestSemaphoreInvariantChecksStrandedWaiter(t *testing.T) {
+	for _, fair := range []bool{false, true} {
+		opts := []Option{WithInvariantChecks()}
+		if fair {
+			opts = append(opts, WithFairness())
+		}
+		sem := NewWithOptions(3, opts...)
+		sem.Acquire()
+
+		// queue waiters behind the semaphore's back, as a bug in handing out
+		// tickets would leave them
+		sem.lock.Lock()
+		sem.waiters.PushBack(&waiter{n: 3})
+		sem.waiters.PushBack(&waiter{n: 2})
+		atomic.AddInt64(&sem.waiting, 2)
+
+		// in fair mode the waiter for two tickets is meant to wait its turn
+		func() {
+			defer func() {
+				val := recover()
+				msg, _ := val.(string)
+				switch {
+				case fair && val != nil:
+					t.Error("waiter behind the front should not count, got", val)
+				case !fair && !strings.Contains(msg, "invariant violated: a waiter for 2 ticket(s) was left queued with 2 free"):
+					t.Error("wrong panic:", val)
+				}
+			}()
+			sem.checkWaiters()
+		}()
+		sem.waiters.Init()
+		atomic.AddInt64(&sem.waiting, -2)
+		sem.lock.Unlock()
+
+		sem.Release()
+	}
+}
+
+func TestSemaphoreInvariantChecksDisabled(t *testing.T) {
+	sem := New(1, 0)
+	atomic.AddInt64(&sem.waiting, -1)
+	defer atomic.AddInt64(&sem.waiting, 1)
+
+	// without the option nothing is checked, even with the build tag
+	sem.Resize(2)
+	if !sem.TryAcquire() {
+		t.Error("semaphore should still be usable")
+	}
+	sem.Release()
+}
@@ -0,0 +1,72 @@
+package semaphore
+
+import (
+	"context"
+	"sync"
+)
+
+// Latch implements a one-shot count-down latch: a barrier that blocks callers
+// of Wait until Done has been called a given number of times, for waiting until
+// a set of tasks has finished. Unlike a sync.WaitGroup the count is fixed up
+// front, surplus calls to Done are harmless, and Wait can be abandoned with a
+// context. Once open, a latch stays open.
+type Latch struct {
+	lock  sync.Mutex
+	count int
+	open  chan struct{} // closed once count reaches zero
+}
+
+// NewLatch constructs a new Latch that opens once Done has been called count
+// times. A latch with a count of zero or less starts out open. It is the latch
+// counterpart to New, which constructs a Semaphore.
+func NewLatch(count int) *Latch {
+	l := &Latch{count: count, open: make(chan struct{})}
+	if count <= 0 {
+		l.count = 0
+		close(l.open)
+	}
+	return l
+}
+
+// Done counts down the latch by one, opening it and releasing every waiter at
+// once if that brings the count to zero. Calls once the latch is already open
+// have no effect. It is safe to call Done concurrently on a single Latch.
+func (l *Latch) Done() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.count == 0 {
+		return
+	}
+	l.count--
+	if l.count == 0 {
+		close(l.open)
+	}
+}
+
+// Wait blocks until the latch is open, returning nil, or until the given context
+// is done, returning ctx.Err(). Any number of callers may wait at once. It is
+// safe to call Wait concurrently on a single Latch.
+func (l *Latch) Wait(ctx context.Context) error {
+	select {
+	case <-l.open:
+		return nil
+	default:
+	}
+
+	select {
+	case <-l.open:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Count returns the number of calls to Done still needed to open the latch, or
+// zero if it is open.
+func (l *Latch) Count() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.count
+}
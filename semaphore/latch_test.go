@@ -0,0 +1,64 @@
+package semaphore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLatch(t *testing.T) {
+	l := NewLatch(2)
+
+	results := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			results <- l.Wait(context.Background())
+		}()
+	}
+
+	l.Done()
+	if l.Count() != 1 {
+		t.Error("expected a count of 1, got", l.Count())
+	}
+	select {
+	case err := <-results:
+		t.Fatal("waiter released too early", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	l.Done()
+	for i := 0; i < 3; i++ {
+		if err := <-results; err != nil {
+			t.Error(err)
+		}
+	}
+
+	// extra calls are no-ops and the latch stays open
+	l.Done()
+	if l.Count() != 0 {
+		t.Error("expected a count of 0, got", l.Count())
+	}
+	if err := l.Wait(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLatchWaitContext(t *testing.T) {
+	l := NewLatch(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx); err != context.DeadlineExceeded {
+		t.Error(err)
+	}
+
+	// an open latch wins over a done context
+	l.Done()
+	if err := l.Wait(ctx); err != nil {
+		t.Error(err)
+	}
+
+	if err := NewLatch(0).Wait(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,95 @@
+package semaphore
+
+import (
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+// LatencyStats summarizes how long successful acquisitions have had to wait for
+// their tickets, as returned by WaitLatency. The percentiles come from a
+// histogram with power-of-two buckets, so they are upper bounds accurate to
+// within a factor of two; Max is exact.
+type LatencyStats struct {
+	// Count is the number of acquisitions recorded.
+	Count         uint64
+	P50, P90, P99 time.Duration
+	Max           time.Duration
+}
+
+// histogram counts durations in buckets, where bucket i holds durations of
+// less than 2^i nanoseconds (and at least 2^(i-1), for i > 0). It is updated
+// with atomic operations only.
+type histogram struct {
+	buckets [65]uint64
+	max     int64
+}
+
+func (h *histogram) record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	atomic.AddUint64(&h.buckets[bits.Len64(uint64(d))], 1)
+	for {
+		max := atomic.LoadInt64(&h.max)
+		if int64(d) <= max || atomic.CompareAndSwapInt64(&h.max, max, int64(d)) {
+			return
+		}
+	}
+}
+
+func (h *histogram) reset() {
+	for i := range h.buckets {
+		atomic.StoreUint64(&h.buckets[i], 0)
+	}
+	atomic.StoreInt64(&h.max, 0)
+}
+
+func (h *histogram) stats() LatencyStats {
+	var counts [len(h.buckets)]uint64
+	var stats LatencyStats
+	for i := range h.buckets {
+		counts[i] = atomic.LoadUint64(&h.buckets[i])
+		stats.Count += counts[i]
+	}
+	stats.Max = time.Duration(atomic.LoadInt64(&h.max))
+
+	percentile := func(p float64) time.Duration {
+		// the rank of the sample we want, rounded up
+		rank := uint64(p*float64(stats.Count) + 0.999999)
+		var seen uint64
+		for i, count := range counts {
+			seen += count
+			if seen >= rank && count > 0 {
+				if i == 0 {
+					return 0
+				}
+				upper := time.Duration(1<<uint(i) - 1)
+				if i >= 63 || upper > stats.Max {
+					return stats.Max
+				}
+				return upper
+			}
+		}
+		return stats.Max
+	}
+
+	if stats.Count > 0 {
+		stats.P50 = percentile(0.50)
+		stats.P90 = percentile(0.90)
+		stats.P99 = percentile(0.99)
+	}
+	return stats
+}
+
+// WaitLatency returns a summary of how long successful acquisitions have waited
+// for their tickets since the semaphore was constructed. It returns the zero
+// LatencyStats unless the semaphore was constructed with WithLatencyHistogram.
+// It is safe to call WaitLatency concurrently with all other methods on a single
+// Semaphore, though the summary may then not include the very latest waits.
+func (s *Semaphore) WaitLatency() LatencyStats {
+	if s.latency == nil {
+		return LatencyStats{}
+	}
+	return s.latency.stats()
+}
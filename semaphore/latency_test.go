@@ -0,0 +1,67 @@
+package semaphore
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistogram(t *testing.T) {
+	h := &histogram{}
+	if stats := h.stats(); stats != (LatencyStats{}) {
+		t.Error("empty histogram should have zero stats", stats)
+	}
+
+	for i := 0; i < 50; i++ {
+		h.record(0)
+	}
+	for i := 0; i < 40; i++ {
+		h.record(1 * time.Millisecond)
+	}
+	for i := 0; i < 9; i++ {
+		h.record(10 * time.Millisecond)
+	}
+	h.record(1 * time.Second)
+
+	stats := h.stats()
+	if stats.Count != 100 || stats.Max != 1*time.Second {
+		t.Error("wrong count or max", stats)
+	}
+	if stats.P50 != 0 {
+		t.Error("wrong p50", stats.P50)
+	}
+	if stats.P90 < 1*time.Millisecond || stats.P90 >= 2*time.Millisecond {
+		t.Error("wrong p90", stats.P90)
+	}
+	if stats.P99 < 10*time.Millisecond || stats.P99 >= 20*time.Millisecond {
+		t.Error("wrong p99", stats.P99)
+	}
+}
+
+func TestSemaphoreWaitLatency(t *testing.T) {
+	sem := New(1, 1*time.Second)
+	sem.Acquire()
+	sem.Release()
+	if stats := sem.WaitLatency(); stats != (LatencyStats{}) {
+		t.Error("latency should not be recorded by default", stats)
+	}
+
+	sem = NewWithOptions(1, WithTimeout(1*time.Second), WithLatencyHistogram())
+	sem.Acquire()
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		sem.Release()
+	}()
+	sem.Acquire()
+	sem.Release()
+
+	stats := sem.WaitLatency()
+	if stats.Count != 2 {
+		t.Error("wrong count", stats.Count)
+	}
+	if stats.Max < 20*time.Millisecond || stats.P99 != stats.Max {
+		t.Error("wrong max", stats)
+	}
+	if stats.P50 != 0 {
+		t.Error("wrong p50", stats.P50)
+	}
+}
@@ -0,0 +1,49 @@
+package semaphore
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// AcquireAll acquires a ticket from each of the given semaphores as if by calling
+// AcquireContext on each in turn. The semaphores are always acquired in the same
+// global order no matter what order they are passed in, so concurrent calls with
+// overlapping sets of semaphores cannot end up waiting on each other. If any
+// acquisition fails, every ticket already acquired is released and the error is
+// returned. Otherwise the returned function releases all the tickets; only its
+// first call has any effect. Passing the same semaphore more than once acquires
+// that many tickets from it.
+func AcquireAll(ctx context.Context, sems ...*Semaphore) (func(), error) {
+	ordered := make([]*Semaphore, len(sems))
+	copy(ordered, sems)
+	sort.Slice(ordered, func(i, j int) bool {
+		return ordered[i].id < ordered[j].id
+	})
+
+	return acquireInOrder(ctx, ordered)
+}
+
+// acquireInOrder acquires a ticket from each semaphore in the order given,
+// rolling back on failure, and returns a function that releases them all once.
+func acquireInOrder(ctx context.Context, ordered []*Semaphore) (func(), error) {
+	for i, sem := range ordered {
+		if err := sem.AcquireContext(ctx); err != nil {
+			releaseEach(ordered[:i])
+			return nil, err
+		}
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			releaseEach(ordered)
+		})
+	}, nil
+}
+
+func releaseEach(sems []*Semaphore) {
+	for i := len(sems) - 1; i >= 0; i-- {
+		sems[i].Release()
+	}
+}
@@ -0,0 +1,71 @@
+package semaphore
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAcquireAll(t *testing.T) {
+	a, b, c := New(1, 10*time.Millisecond), New(2, 10*time.Millisecond), New(1, 10*time.Millisecond)
+
+	release, err := AcquireAll(context.Background(), c, a, b, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.InUse() != 1 || b.InUse() != 2 || c.InUse() != 1 {
+		t.Error("wrong tickets held")
+	}
+	release()
+	release()
+	if !a.IsEmpty() || !b.IsEmpty() || !c.IsEmpty() {
+		t.Error("all tickets should have been released once")
+	}
+
+	// a failure part-way releases everything already acquired
+	c.Acquire()
+	if _, err := AcquireAll(context.Background(), a, b, c); !errors.Is(err, ErrNoTickets) {
+		t.Error(err)
+	}
+	if !a.IsEmpty() || !b.IsEmpty() {
+		t.Error("tickets should have been rolled back")
+	}
+	c.Release()
+}
+
+func TestAcquireAllOrdering(t *testing.T) {
+	a, b := New(1, 1*time.Second), New(1, 1*time.Second)
+
+	// opposite argument orders would deadlock until the timeout if the
+	// acquisitions weren't consistently ordered
+	start := time.Now()
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			release, err := AcquireAll(context.Background(), a, b)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			release()
+		}()
+		go func() {
+			defer wg.Done()
+			release, err := AcquireAll(context.Background(), b, a)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			release()
+		}()
+	}
+	wg.Wait()
+
+	if time.Since(start) >= 1*time.Second {
+		t.Error("acquisitions waited on each other")
+	}
+}
@@ -0,0 +1,74 @@
+package semaphore
+
+// Event is a change in the state of a Semaphore, as delivered by Notify.
+type Event int
+
+const (
+	// Saturated means that every ticket has become held, so that further
+	// acquisitions will have to wait.
+	Saturated Event = iota + 1
+	// Unsaturated means that tickets have become available again after the
+	// semaphore was saturated.
+	Unsaturated
+)
+
+// notifyBuffer is how many events Notify buffers for a slow consumer.
+const notifyBuffer = 16
+
+func (e Event) String() string {
+	switch e {
+	case Saturated:
+		return "saturated"
+	case Unsaturated:
+		return "unsaturated"
+	}
+	return "unknown"
+}
+
+// Notify returns a channel on which an Event is sent every time the semaphore
+// becomes saturated (every ticket is held) or stops being so, as an
+// event-driven alternative to polling Stats. Every call returns the same
+// channel, and events are only generated once Notify has first been called.
+//
+// Delivery is lossy: the channel is buffered, and if the consumer falls behind
+// by more than the buffer then new events are dropped rather than blocking the
+// semaphore. Events therefore always alternate when none are dropped, but a
+// consumer that needs the current state should confirm it with Stats or
+// Available rather than relying on the last event received. The channel is never
+// closed. It is safe to call Notify concurrently with all other methods on a
+// single Semaphore.
+func (s *Semaphore) Notify() <-chan Event {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.events == nil {
+		s.events = make(chan Event, notifyBuffer)
+		s.updateSlow()
+		// only read the state once the slow path is on, so that the fast path
+		// can't change it unnoticed
+		s.saturated = s.loadHeld() >= s.loadTickets()
+	}
+	return s.events
+}
+
+// checkSaturation sends an event if the semaphore has become saturated or
+// unsaturated since the last one. It must be called with the lock held.
+func (s *Semaphore) checkSaturation() {
+	if s.events == nil {
+		return
+	}
+	saturated := s.loadHeld() >= s.loadTickets()
+	if saturated == s.saturated {
+		return
+	}
+	s.saturated = saturated
+
+	event := Unsaturated
+	if saturated {
+		event = Saturated
+	}
+	select {
+	case s.events <- event:
+	default:
+	}
+}
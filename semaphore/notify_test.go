@@ -0,0 +1,75 @@
+package semaphore
+
+import (
+	"testing"
+	"time"
+)
+
+func expectEvent(t *testing.T, events <-chan Event, expected Event) {
+	t.Helper()
+	select {
+	case event := <-events:
+		if event != expected {
+			t.Errorf("expected %v, got %v", expected, event)
+		}
+	default:
+		t.Errorf("expected %v, got nothing", expected)
+	}
+}
+
+func expectNoEvent(t *testing.T, events <-chan Event) {
+	t.Helper()
+	select {
+	case event := <-events:
+		t.Error("unexpected event", event)
+	default:
+	}
+}
+
+func TestSemaphoreNotify(t *testing.T) {
+	sem := New(2, 1*time.Second)
+	events := sem.Notify()
+	if sem.Notify() != events {
+		t.Error("Notify should always return the same channel")
+	}
+
+	sem.Acquire()
+	expectNoEvent(t, events)
+	sem.TryAcquire()
+	expectEvent(t, events, Saturated)
+
+	// handing a released ticket straight to a waiter stays saturated
+	done := make(chan error)
+	go func() {
+		done <- sem.Acquire()
+	}()
+	for sem.WaitCount() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	sem.Release()
+	<-done
+	expectNoEvent(t, events)
+
+	sem.Release()
+	expectEvent(t, events, Unsaturated)
+
+	sem.Resize(1)
+	expectEvent(t, events, Saturated)
+	sem.Resize(3)
+	expectEvent(t, events, Unsaturated)
+	sem.Release()
+	expectNoEvent(t, events)
+}
+
+func TestSemaphoreNotifyDropsEvents(t *testing.T) {
+	sem := New(1, 1*time.Second)
+	events := sem.Notify()
+
+	for i := 0; i < 2*notifyBuffer; i++ {
+		sem.Acquire()
+		sem.Release()
+	}
+	if len(events) != notifyBuffer {
+		t.Error("events should be dropped once the buffer is full, got", len(events))
+	}
+}
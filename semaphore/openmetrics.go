@@ -0,0 +1,48 @@
+package semaphore
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// WriteOpenMetrics writes the semaphore's current Stats to w in the OpenMetrics
+// text format, which Prometheus can also scrape, without needing any metrics
+// library. Every metric name starts with the given prefix, which defaults to
+// "semaphore_" if empty, and every sample is labelled with the semaphore's name;
+// the metrics, and the Stats they are read from, are the same as those exported
+// by the semprom package. When several semaphores are served from one endpoint
+// each should be given its own prefix, since a metric family may only be
+// described once. The output is not terminated with "# EOF", so that it can be
+// combined with other metrics; the caller should write that line once
+// everything has been written.
+func (s *Semaphore) WriteOpenMetrics(w io.Writer, prefix string) error {
+	if prefix == "" {
+		prefix = "semaphore_"
+	}
+	stats := s.Stats()
+	label := labelEscaper.Replace(s.name)
+
+	var buf bytes.Buffer
+	metric := func(name, typ, help string, value uint64) {
+		sample := name
+		if typ == "counter" {
+			sample += "_total"
+		}
+		fmt.Fprintf(&buf, "# TYPE %s%s %s\n", prefix, name, typ)
+		fmt.Fprintf(&buf, "# HELP %s%s %s\n", prefix, name, help)
+		fmt.Fprintf(&buf, "%s%s{name=\"%s\"} %d\n", prefix, sample, label, value)
+	}
+	metric("capacity", "gauge", "Total number of tickets the semaphore hands out.", uint64(stats.Capacity))
+	metric("in_use", "gauge", "Number of tickets currently held.", uint64(stats.InUse))
+	metric("available", "gauge", "Number of tickets currently available.", uint64(stats.Available))
+	metric("waiting", "gauge", "Number of callers currently waiting for a ticket.", uint64(stats.Waiting))
+	metric("acquired", "counter", "Total number of successful acquisitions.", stats.TotalAcquired)
+	metric("timeouts", "counter", "Total number of acquisitions that timed out.", stats.TotalTimeouts)
+
+	_, err := buf.WriteTo(w)
+	return err
+}
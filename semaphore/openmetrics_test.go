@@ -0,0 +1,58 @@
+package semaphore
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+func TestSemaphoreWriteOpenMetrics(t *testing.T) {
+	sem := NewWithOptions(2, WithName(`db "main"`), WithTimeout(10*time.Millisecond))
+	sem.AcquireN(2)
+	sem.Acquire()
+
+	var buf bytes.Buffer
+	if err := sem.WriteOpenMetrics(&buf, ""); err != nil {
+		t.Fatal(err)
+	}
+	expected := `# TYPE semaphore_capacity gauge
+# HELP semaphore_capacity Total number of tickets the semaphore hands out.
+semaphore_capacity{name="db \"main\""} 2
+# TYPE semaphore_in_use gauge
+# HELP semaphore_in_use Number of tickets currently held.
+semaphore_in_use{name="db \"main\""} 2
+# TYPE semaphore_available gauge
+# HELP semaphore_available Number of tickets currently available.
+semaphore_available{name="db \"main\""} 0
+# TYPE semaphore_waiting gauge
+# HELP semaphore_waiting Number of callers currently waiting for a ticket.
+semaphore_waiting{name="db \"main\""} 0
+# TYPE semaphore_acquired counter
+# HELP semaphore_acquired Total number of successful acquisitions.
+semaphore_acquired_total{name="db \"main\""} 1
+# TYPE semaphore_timeouts counter
+# HELP semaphore_timeouts Total number of acquisitions that timed out.
+semaphore_timeouts_total{name="db \"main\""} 1
+`
+	if buf.String() != expected {
+		t.Errorf("unexpected output:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	sem.WriteOpenMetrics(&buf, "app_db_")
+	if !strings.Contains(buf.String(), "\napp_db_in_use{") {
+		t.Error("prefix not applied:", buf.String())
+	}
+
+	if err := sem.WriteOpenMetrics(failingWriter{}, ""); err == nil {
+		t.Error("write errors should be returned")
+	}
+}
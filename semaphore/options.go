@@ -0,0 +1,249 @@
+package semaphore
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Option configures a Semaphore constructed with NewWithOptions.
+type Option func(*Semaphore)
+
+// NewWithOptions constructs a new Semaphore with the given ticket-count, configured
+// by the given options. Without WithTimeout the timeout is zero, so acquisitions
+// fail immediately when no ticket is available.
+func NewWithOptions(tickets int, opts ...Option) *Semaphore {
+	s := New(tickets, 0)
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// WithTimeout sets how long the semaphore waits for a ticket if none are
+// currently available.
+func WithTimeout(timeout time.Duration) Option {
+	return func(s *Semaphore) {
+		s.timeout = int64(timeout)
+	}
+}
+
+// WithTimeoutFunc makes the semaphore call the given function whenever an
+// acquisition finds no ticket immediately available, to decide how long it may
+// wait for one, so that the timeout can follow a changing budget such as the
+// current load. The function takes precedence over any timeout set by
+// WithTimeout, New or SetTimeout. It may be called concurrently, and a result of
+// zero or less means acquisitions do not wait at all.
+func WithTimeoutFunc(timeout func() time.Duration) Option {
+	return func(s *Semaphore) {
+		s.timeoutFunc = timeout
+	}
+}
+
+// WithWorkTimeout bounds how long the work run by DoContext may take once it has
+// its ticket: the context passed to the work is given a deadline d after the
+// ticket was acquired, and is cancelled once that passes, so that the semaphore
+// also enforces a per-operation deadline. This is distinct from the timeout set
+// by WithTimeout, which only bounds how long to wait for a ticket before the
+// work starts; the two are independent, and the work's context still has any
+// earlier deadline of the context given to DoContext. A timeout of zero or less
+// means the work is not bounded, which is the default. It has no effect on Do,
+// which passes no context to its work.
+func WithWorkTimeout(d time.Duration) Option {
+	return func(s *Semaphore) {
+		s.workTimeout = d
+	}
+}
+
+// WithTimeoutJitter makes every acquisition that uses the semaphore's timeout
+// wait for a randomly adjusted timeout instead, anywhere between (1-frac) and
+// (1+frac) times the configured one, so that callers sharing a timeout do not
+// all give up, and retry, at the same moment. frac must be between 0 and 1
+// inclusive; other values are silently ignored. With WithTimeoutFunc the
+// jitter is applied on top of the function's result. The random numbers come
+// from a source seeded when the option is applied, unless WithJitterSource
+// provides one. Methods that take an explicit timeout, such as AcquireTimeout,
+// are not jittered.
+func WithTimeoutJitter(frac float64) Option {
+	return func(s *Semaphore) {
+		if frac < 0 || frac > 1 {
+			return
+		}
+		s.jitter = frac
+		if s.rand == nil {
+			s.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+		}
+	}
+}
+
+// WithJitterSource makes WithTimeoutJitter draw its random numbers from the
+// given source, for example one with a fixed seed to make tests deterministic.
+// The semaphore serializes its use of the source, so it need not be safe for
+// concurrent use.
+func WithJitterSource(src rand.Source) Option {
+	return func(s *Semaphore) {
+		s.rand = rand.New(src)
+	}
+}
+
+// WithName sets a name for the semaphore, useful for telling semaphores apart
+// in logs and metrics.
+func WithName(name string) Option {
+	return func(s *Semaphore) {
+		s.name = name
+	}
+}
+
+// WithFairness makes the semaphore hand out tickets strictly in the order they
+// were asked for. By default a caller may take a free ticket even while others
+// are waiting, and a released ticket goes to the first waiter it can satisfy,
+// which under heavy contention can leave some callers starving. With fairness
+// enabled, callers queue behind any existing waiters instead. This includes
+// callers of AcquireN: a waiter asking for several tickets blocks everyone who
+// arrives after it, even those asking for fewer tickets than are free, until
+// enough tickets have been released to serve it. That head-of-line blocking is
+// what stops a stream of small requests from starving a large one, but it costs
+// throughput, since tickets stay idle while they accumulate for the large
+// request. This is slightly slower, so it is not the default.
+func WithFairness() Option {
+	return func(s *Semaphore) {
+		s.fair = true
+	}
+}
+
+// WithMaxWaiters limits how many callers may wait for tickets at once. Once n
+// callers are waiting, further attempts to acquire tickets that are not
+// immediately available fail straight away with ErrTooManyWaiters instead of
+// joining the queue, shedding load rather than letting it pile up. The limit
+// applies to the same count reported by WaitCount. A limit of zero or less means
+// there is no limit, which is the default.
+func WithMaxWaiters(n int) Option {
+	return func(s *Semaphore) {
+		s.maxWaiters = n
+	}
+}
+
+// WithLeakTracking makes the semaphore record the stack trace of every Ticket
+// acquired with AcquireTicket until it is released, so that AssertNoLeaks can
+// point at the source of any leak. Capturing stack traces is expensive, so this
+// is meant for tests; without it, tickets carry no tracking overhead.
+func WithLeakTracking() Option {
+	return func(s *Semaphore) {
+		s.tracked = make(map[*Ticket]struct{})
+	}
+}
+
+// WithWaiterStacks makes the semaphore record the stack trace of every caller
+// that has to wait for tickets, so that DumpWaiters can show where each waiter
+// is blocked when debugging a hang. Capturing stack traces is expensive, so this
+// is meant for debugging; without it, DumpWaiters still reports the waiters but
+// without their stacks.
+func WithWaiterStacks() Option {
+	return func(s *Semaphore) {
+		s.waiterStacks = true
+	}
+}
+
+// WithLatencyHistogram makes the semaphore record how long every successful
+// acquisition waited for its tickets, so that the distribution can be retrieved
+// with WaitLatency. Recording is cheap and lock-free, but is still disabled by
+// default.
+func WithLatencyHistogram() Option {
+	return func(s *Semaphore) {
+		s.latency = &histogram{}
+	}
+}
+
+// WithHealthGracePeriod sets how long the semaphore may stay saturated before
+// Healthy reports it as unhealthy. The default is DefaultHealthGracePeriod.
+func WithHealthGracePeriod(grace time.Duration) Option {
+	return func(s *Semaphore) {
+		s.healthGrace = grace
+	}
+}
+
+// WithTracer makes the semaphore report every acquisition made with
+// AcquireContext, or with the methods built on it such as DoContext, to the
+// given Tracer. By default acquisitions are not traced.
+func WithTracer(tracer Tracer) Option {
+	return func(s *Semaphore) {
+		if _, nop := tracer.(NopTracer); nop {
+			tracer = nil
+		}
+		s.tracer = tracer
+	}
+}
+
+// WithShedWhenUnhealthy makes the semaphore shed load once it becomes unhealthy,
+// as reported by Healthy: acquisitions that would have to wait fail immediately
+// with ErrNoTickets instead of joining the queue, giving callers fast feedback
+// during sustained overload. Acquisitions that can be satisfied straight away are
+// unaffected. To avoid flapping, the semaphore only stops shedding once a ticket
+// is actually free again rather than as soon as the queue has drained, so it
+// recovers when demand falls back below capacity.
+func WithShedWhenUnhealthy() Option {
+	return func(s *Semaphore) {
+		s.shedWhenUnhealthy = true
+	}
+}
+
+// WithOnAcquire adds a hook that is called after every successful acquisition
+// with how long the caller had to wait for its tickets. The hook is called
+// without any internal lock held, so it may safely use the semaphore. If several
+// hooks are added for the same event they are called in the order given.
+func WithOnAcquire(hook func(waited time.Duration)) Option {
+	return func(s *Semaphore) {
+		s.onAcquire = chainWaited(s.onAcquire, hook)
+	}
+}
+
+// WithOnRelease adds a hook that is called after every release. The hook is
+// called without any internal lock held, so it may safely use the semaphore. If
+// several hooks are added for the same event they are called in the order given.
+func WithOnRelease(hook func()) Option {
+	return func(s *Semaphore) {
+		s.onRelease = chain(s.onRelease, hook)
+	}
+}
+
+// WithOnTimeout adds a hook that is called whenever an acquisition fails with
+// ErrNoTickets, with how long the caller waited before giving up. The hook is
+// called without any internal lock held, so it may safely use the semaphore. If
+// several hooks are added for the same event they are called in the order given.
+func WithOnTimeout(hook func(waited time.Duration)) Option {
+	return func(s *Semaphore) {
+		s.onTimeout = chainWaited(s.onTimeout, hook)
+	}
+}
+
+// WithOnWait adds a hook that is called whenever an acquisition finds that its
+// tickets are not immediately available and is about to start waiting for them.
+// Unlike WithOnAcquire it is not called for acquisitions that succeed straight
+// away, nor for those which fail without waiting, so it counts exactly the
+// contended acquisitions. The hook is called without any internal lock held, so
+// it may safely use the semaphore. If several hooks are added for the same
+// event they are called in the order given.
+func WithOnWait(hook func()) Option {
+	return func(s *Semaphore) {
+		s.onWait = chain(s.onWait, hook)
+	}
+}
+
+func chain(first, second func()) func() {
+	if first == nil {
+		return second
+	}
+	return func() {
+		first()
+		second()
+	}
+}
+
+func chainWaited(first, second func(time.Duration)) func(time.Duration) {
+	if first == nil {
+		return second
+	}
+	return func(waited time.Duration) {
+		first(waited)
+		second(waited)
+	}
+}
@@ -0,0 +1,293 @@
+package semaphore
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewWithOptions(t *testing.T) {
+	sem := NewWithOptions(2)
+	if sem.Cap() != 2 || sem.Name() != "" {
+		t.Error("wrong defaults")
+	}
+	sem.AcquireN(2)
+	start := time.Now()
+	if err := sem.Acquire(); !errors.Is(err, ErrNoTickets) {
+		t.Error(err)
+	}
+	if time.Since(start) >= 100*time.Millisecond {
+		t.Error("semaphore should not have waited")
+	}
+
+	sem = NewWithOptions(1, WithTimeout(50*time.Millisecond), WithName("db"))
+	if sem.Name() != "db" {
+		t.Error("wrong name", sem.Name())
+	}
+	sem.Acquire()
+	start = time.Now()
+	if err := sem.Acquire(); !errors.Is(err, ErrNoTickets) {
+		t.Error(err)
+	}
+	if start.Add(50 * time.Millisecond).After(time.Now()) {
+		t.Error("semaphore did not wait long enough")
+	}
+}
+
+func TestWithTimeoutFunc(t *testing.T) {
+	budget := 50 * time.Millisecond
+	calls := 0
+	sem := NewWithOptions(1, WithTimeout(time.Hour), WithTimeoutFunc(func() time.Duration {
+		calls++
+		return budget
+	}))
+	if sem.Timeout() != budget {
+		t.Error("timeout func should win over the fixed timeout, got", sem.Timeout())
+	}
+
+	sem.Acquire()
+	start := time.Now()
+	var timeoutErr *TimeoutError
+	if err := sem.Acquire(); !errors.As(err, &timeoutErr) || timeoutErr.Timeout != budget {
+		t.Error(err)
+	}
+	if time.Since(start) < budget {
+		t.Error("semaphore did not wait long enough")
+	}
+
+	budget = 0
+	sem.SetTimeout(time.Hour)
+	start = time.Now()
+	if err := sem.Acquire(); !errors.Is(err, ErrNoTickets) {
+		t.Error(err)
+	}
+	if time.Since(start) >= 100*time.Millisecond {
+		t.Error("semaphore should not have waited")
+	}
+	// the uncontended Acquire never needed the timeout
+	if calls != 3 {
+		t.Error("expected the timeout func to be called for each wait, got", calls)
+	}
+}
+
+func TestWithWorkTimeout(t *testing.T) {
+	sem := NewWithOptions(1, WithTimeout(time.Second), WithWorkTimeout(10*time.Millisecond))
+
+	err := sem.DoContext(context.Background(), func(ctx context.Context) error {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("work should have a deadline")
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+			return nil
+		}
+	})
+	if err != context.DeadlineExceeded {
+		t.Error("overrunning work should be cancelled, got", err)
+	}
+	if !sem.IsEmpty() {
+		t.Error("semaphore should be empty")
+	}
+
+	// without the option the work is unbounded
+	plain := New(1, time.Second)
+	plain.DoContext(context.Background(), func(ctx context.Context) error {
+		if _, ok := ctx.Deadline(); ok {
+			t.Error("work should have no deadline")
+		}
+		return nil
+	})
+}
+
+func TestWithTimeoutJitter(t *testing.T) {
+	base := 20 * time.Millisecond
+	timeouts := func() []time.Duration {
+		sem := NewWithOptions(1, WithTimeout(base), WithJitterSource(rand.NewSource(1)), WithTimeoutJitter(0.5))
+		sem.Acquire()
+		var result []time.Duration
+		for i := 0; i < 3; i++ {
+			var timeoutErr *TimeoutError
+			if err := sem.Acquire(); !errors.As(err, &timeoutErr) {
+				t.Fatal(err)
+			}
+			if timeoutErr.Timeout < base/2 || timeoutErr.Timeout > base*3/2 {
+				t.Error("jittered timeout out of range:", timeoutErr.Timeout)
+			}
+			result = append(result, timeoutErr.Timeout)
+		}
+		if sem.Timeout() != base {
+			t.Error("the configured timeout should not be jittered, got", sem.Timeout())
+		}
+		return result
+	}
+
+	first := timeouts()
+	if first[0] == first[1] && first[1] == first[2] {
+		t.Error("timeouts should be jittered", first)
+	}
+	if second := timeouts(); !reflect.DeepEqual(first, second) {
+		t.Error("the same source should give the same timeouts", first, second)
+	}
+
+	sem := NewWithOptions(1, WithTimeout(base), WithTimeoutJitter(2))
+	if sem.defaultTimeout() != base {
+		t.Error("an invalid jitter should be ignored")
+	}
+}
+
+func TestFairness(t *testing.T) {
+	sem := NewWithOptions(1, WithTimeout(1*time.Second), WithFairness())
+	sem.Acquire()
+
+	const waiters = 10
+	order := make(chan int, waiters)
+	for i := 0; i < waiters; i++ {
+		go func(i int) {
+			if err := sem.Acquire(); err != nil {
+				t.Error(err)
+			}
+			order <- i
+			sem.Release()
+		}(i)
+		// make sure each waiter is queued before starting the next one
+		for sem.WaitCount() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// a newcomer must not jump the queue
+	if sem.TryAcquire() {
+		t.Error("fair semaphore let a newcomer jump the queue")
+	}
+
+	sem.Release()
+	for i := 0; i < waiters; i++ {
+		if got := <-order; got != i {
+			t.Errorf("waiter %d was woken in position %d", got, i)
+		}
+	}
+}
+
+func TestFairnessAcquireNNotStarved(t *testing.T) {
+	sem := NewWithOptions(5, WithTimeout(1*time.Second), WithFairness())
+
+	// a flood of unit acquisitions that would always find a free ticket
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if sem.AcquireN(1) == nil {
+					time.Sleep(100 * time.Microsecond)
+					sem.ReleaseN(1)
+				}
+			}
+		}()
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if err := sem.AcquireN(5); err != nil {
+		t.Error("large acquisition was starved:", err)
+	} else {
+		sem.ReleaseN(5)
+	}
+
+	close(stop)
+	wg.Wait()
+}
+
+func TestMaxWaiters(t *testing.T) {
+	sem := NewWithOptions(1, WithTimeout(1*time.Second), WithMaxWaiters(2))
+	sem.Acquire()
+
+	done := make(chan error)
+	for i := 0; i < 2; i++ {
+		go func() {
+			done <- sem.Acquire()
+		}()
+	}
+	for sem.WaitCount() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	start := time.Now()
+	if err := sem.Acquire(); err != ErrTooManyWaiters {
+		t.Error(err)
+	}
+	if time.Since(start) >= 1*time.Second {
+		t.Error("semaphore should not have waited")
+	}
+
+	sem.Release()
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+	sem.Release()
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+	sem.Release()
+}
+
+func TestLifecycleHooks(t *testing.T) {
+	var acquired, released, timedOut []time.Duration
+	waited := 0
+	var sem *Semaphore
+	sem = NewWithOptions(1,
+		WithTimeout(20*time.Millisecond),
+		WithOnAcquire(func(waited time.Duration) {
+			acquired = append(acquired, waited)
+			sem.InUse() // must not deadlock
+		}),
+		WithOnRelease(func() {
+			released = append(released, 0)
+			sem.InUse()
+		}),
+		WithOnTimeout(func(waited time.Duration) {
+			timedOut = append(timedOut, waited)
+			sem.InUse()
+		}),
+		WithOnWait(func() {
+			waited++
+			sem.InUse()
+		}),
+	)
+
+	sem.Acquire()
+	sem.Acquire()
+	sem.Release()
+	sem.TryRelease()
+	sem.TryAcquire()
+
+	if len(acquired) != 2 || acquired[0] != 0 || acquired[1] != 0 {
+		t.Error("wrong acquire hook calls", acquired)
+	}
+	if len(released) != 1 {
+		t.Error("wrong release hook calls", released)
+	}
+	if len(timedOut) != 1 || timedOut[0] < 20*time.Millisecond {
+		t.Error("wrong timeout hook calls", timedOut)
+	}
+	if waited != 1 {
+		t.Error("wait hook should only be called for the contended acquisition, got", waited)
+	}
+
+	// a non-blocking attempt never waits
+	sem.AcquireTimeout(0)
+	if waited != 1 {
+		t.Error("wait hook should not be called without waiting, got", waited)
+	}
+}
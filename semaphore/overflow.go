@@ -0,0 +1,64 @@
+package semaphore
+
+import (
+	"container/list"
+	"errors"
+)
+
+// ErrPreempted is the error returned to a waiting caller that was evicted from
+// the wait queue to make room for a newer one, under PolicyReplaceOldest.
+var ErrPreempted = errors.New("semaphore waiter preempted by a newer caller")
+
+// Policy decides what a semaphore does with callers that arrive while no ticket
+// is available, as set by WithOverflowPolicy.
+type Policy int
+
+const (
+	// PolicyBlock makes callers wait for a ticket for up to the timeout, or
+	// until their context is done, and then fail with ErrNoTickets. It is the
+	// default, and works with or without fairness.
+	PolicyBlock Policy = iota
+	// PolicyReject makes callers fail with ErrNoTickets straight away, without
+	// waiting or starting a timer, whatever timeout or context they were given.
+	// It works with or without fairness.
+	PolicyReject
+	// PolicyReplaceOldest only differs from PolicyBlock once the wait queue is
+	// full, which requires both fairness (see WithFairness) and a limit on
+	// waiters (see WithMaxWaiters); without them it behaves exactly like
+	// PolicyBlock. Then, instead of the newcomer failing with
+	// ErrTooManyWaiters, the caller that has been waiting longest is evicted
+	// and fails with ErrPreempted, and the newcomer takes its place in the
+	// queue. Waiters still give up with ErrNoTickets once their timeout expires,
+	// so under this policy a caller fails either by timing out or by being
+	// preempted, whichever comes first. It suits work where a fresh request is
+	// worth more than a stale one.
+	PolicyReplaceOldest
+)
+
+// WithOverflowPolicy sets what the semaphore does with callers that arrive while
+// no ticket is available; see Policy for the choices and how they interact
+// with fairness and the timeout. The default is PolicyBlock.
+func WithOverflowPolicy(p Policy) Option {
+	return func(s *Semaphore) {
+		s.policy = p
+	}
+}
+
+// preemptOldest evicts the waiter that has been waiting longest from the wait
+// queue, failing it with ErrPreempted. It must be called with the lock held and
+// at least one waiter queued.
+func (s *Semaphore) preemptOldest() {
+	var oldest *list.Element
+	for elem := s.waiters.Front(); elem != nil; elem = elem.Next() {
+		// with priorities the queue is not in arrival order
+		if oldest == nil || elem.Value.(*waiter).since.Before(oldest.Value.(*waiter).since) {
+			oldest = elem
+		}
+	}
+
+	w := s.waiters.Remove(oldest).(*waiter)
+	w.err = ErrPreempted
+	close(w.ready)
+	// the evicted waiter may have been blocking the ones behind it
+	s.notifyWaiters()
+}
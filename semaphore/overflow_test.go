@@ -0,0 +1,88 @@
+package semaphore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestOverflowPolicyReject(t *testing.T) {
+	sem := NewWithOptions(1, WithTimeout(time.Second), WithOverflowPolicy(PolicyReject))
+	sem.Acquire()
+
+	start := time.Now()
+	if err := sem.Acquire(); !errors.Is(err, ErrNoTickets) {
+		t.Error(err)
+	}
+	if err := sem.AcquireTimeout(-1); !errors.Is(err, ErrNoTickets) {
+		t.Error(err)
+	}
+	if err := sem.AcquireContext(context.Background()); !errors.Is(err, ErrNoTickets) {
+		t.Error(err)
+	}
+	if elapsed := time.Since(start); elapsed >= 100*time.Millisecond {
+		t.Error("semaphore should not have waited", elapsed)
+	}
+	if counters := sem.CountersSnapshot(false); counters.Rejected != 3 || counters.TimedOut != 0 {
+		t.Errorf("expected 3 rejections and no timeouts, got %+v", counters)
+	}
+
+	sem.Release()
+	if err := sem.Acquire(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOverflowPolicyReplaceOldest(t *testing.T) {
+	sem := NewWithOptions(1, WithTimeout(time.Second), WithFairness(), WithMaxWaiters(2), WithOverflowPolicy(PolicyReplaceOldest))
+	sem.Acquire()
+
+	results := make([]chan error, 3)
+	for i := range results {
+		results[i] = make(chan error, 1)
+		go func(i int) {
+			results[i] <- sem.Acquire()
+		}(i)
+		// make sure the waiters queue up in order
+		for sem.WaitCount() < i+1 && i < 2 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	if err := <-results[0]; err != ErrPreempted {
+		t.Error(err)
+	}
+
+	sem.Release()
+	if err := <-results[1]; err != nil {
+		t.Error(err)
+	}
+	sem.Release()
+	if err := <-results[2]; err != nil {
+		t.Error(err)
+	}
+	sem.Release()
+}
+
+func TestOverflowPolicyReplaceOldestNeedsFairness(t *testing.T) {
+	sem := NewWithOptions(1, WithTimeout(time.Second), WithMaxWaiters(1), WithOverflowPolicy(PolicyReplaceOldest))
+	sem.Acquire()
+
+	result := make(chan error, 1)
+	go func() {
+		result <- sem.Acquire()
+	}()
+	for sem.WaitCount() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := sem.Acquire(); err != ErrTooManyWaiters {
+		t.Error(err)
+	}
+	sem.Release()
+	if err := <-result; err != nil {
+		t.Error(err)
+	}
+	sem.Release()
+}
@@ -0,0 +1,48 @@
+package semaphore
+
+import "errors"
+
+// ErrPaused is the error returned by the acquire methods while the semaphore is
+// paused.
+var ErrPaused = errors.New("semaphore is paused")
+
+// Pause temporarily stops the semaphore from admitting work, for maintenance.
+// Until Resume is called every attempt to acquire tickets fails with ErrPaused
+// (or false, for the non-blocking methods), and any callers that are currently
+// waiting for tickets are woken and also fail with ErrPaused. Tickets that are
+// already held are unaffected and should still be released as normal; use Drain
+// to wait for that to happen. Unlike Close, pausing is reversible and keeps the
+// semaphore's statistics, so it need not be replaced, for example in a
+// Registry. Pausing a paused semaphore has no effect. Once closed, a semaphore
+// reports ErrClosed whether or not it is also paused. It is safe to call Pause
+// concurrently with all other methods on a single Semaphore.
+func (s *Semaphore) Pause() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.paused {
+		return
+	}
+	s.paused = true
+	s.failWaiters(ErrPaused)
+}
+
+// Resume makes a paused semaphore admit work again. Resuming a semaphore that
+// is not paused has no effect, and in particular Resume does not reopen a
+// closed semaphore. It is safe to call Resume concurrently with all other
+// methods on a single Semaphore.
+func (s *Semaphore) Resume() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.paused = false
+	s.updateSlow()
+}
+
+// IsPaused reports whether the semaphore is paused.
+func (s *Semaphore) IsPaused() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.paused
+}
@@ -0,0 +1,64 @@
+package semaphore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSemaphorePauseResume(t *testing.T) {
+	sem := New(2, time.Second)
+	sem.AcquireN(2)
+
+	waiting := make(chan error, 1)
+	go func() {
+		waiting <- sem.Acquire()
+	}()
+	for sem.WaitCount() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	sem.Pause()
+	if err := <-waiting; err != ErrPaused {
+		t.Error("waiters should fail with ErrPaused, got", err)
+	}
+	if !sem.IsPaused() {
+		t.Error("semaphore should be paused")
+	}
+
+	// held tickets are unaffected, but nothing new is admitted
+	sem.Release()
+	if err := sem.Acquire(); err != ErrPaused {
+		t.Error(err)
+	}
+	if sem.TryAcquire() {
+		t.Error("TryAcquire should fail while paused")
+	}
+	if ok, err := sem.TryAcquireContext(context.Background()); ok || err != ErrPaused {
+		t.Error(ok, err)
+	}
+	if sem.InUse() != 1 {
+		t.Error("expected 1 ticket held, got", sem.InUse())
+	}
+
+	sem.Resume()
+	if sem.IsPaused() {
+		t.Error("semaphore should not be paused")
+	}
+	if err := sem.Acquire(); err != nil {
+		t.Error(err)
+	}
+	if sem.TotalAcquired() != 2 {
+		t.Error("statistics should be kept across a pause, got", sem.TotalAcquired())
+	}
+	sem.ReleaseN(2)
+
+	// a closed semaphore stays closed, and resuming does not reopen it
+	sem.Pause()
+	sem.Close()
+	sem.Resume()
+	if err := sem.Acquire(); !errors.Is(err, ErrClosed) {
+		t.Error(err)
+	}
+}
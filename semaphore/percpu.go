@@ -0,0 +1,22 @@
+package semaphore
+
+import (
+	"runtime"
+	"time"
+)
+
+// NewPerCPU constructs a new Semaphore with perCPU tickets for every CPU the Go
+// runtime may use, as reported by runtime.GOMAXPROCS, and the given timeout.
+// GOMAXPROCS is only read when NewPerCPU is called; if it changes later, for
+// example after the container's CPU limit is updated, call Rescale.
+func NewPerCPU(perCPU int, timeout time.Duration) *Semaphore {
+	return New(perCPU*runtime.GOMAXPROCS(0), timeout)
+}
+
+// Rescale resizes the semaphore, as if by Resize, to perCPU tickets for every
+// CPU the Go runtime may use, as reported by runtime.GOMAXPROCS at the time of
+// the call. It returns ErrInvalidTickets if perCPU is negative. It is safe to
+// call Rescale concurrently with all other methods on a single Semaphore.
+func (s *Semaphore) Rescale(perCPU int) error {
+	return s.Resize(perCPU * runtime.GOMAXPROCS(0))
+}
@@ -0,0 +1,31 @@
+package semaphore
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestSemaphorePerCPU(t *testing.T) {
+	procs := runtime.GOMAXPROCS(0)
+	defer runtime.GOMAXPROCS(procs)
+
+	sem := NewPerCPU(2, time.Second)
+	if sem.Cap() != 2*procs || sem.Timeout() != time.Second {
+		t.Error(sem.Cap(), sem.Timeout())
+	}
+
+	runtime.GOMAXPROCS(procs + 1)
+	if sem.Cap() != 2*procs {
+		t.Error("ticket-count should not change until Rescale")
+	}
+	if err := sem.Rescale(3); err != nil {
+		t.Error(err)
+	}
+	if sem.Cap() != 3*(procs+1) {
+		t.Error(sem.Cap())
+	}
+	if err := sem.Rescale(-1); err != ErrInvalidTickets {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,83 @@
+//go:build go1.18
+// +build go1.18
+
+package semaphore
+
+import (
+	"context"
+	"sync"
+)
+
+// Pool is a bounded pool of resources of type T, such as connections. The number
+// of resources handed out at once is limited by a Semaphore; released resources
+// are kept and handed out again rather than constructed anew.
+type Pool[T any] struct {
+	sem     *Semaphore
+	factory func() (T, error)
+
+	lock sync.Mutex
+	idle []T
+}
+
+// NewPool constructs a new Pool which limits the resources handed out at once to
+// the tickets of the given semaphore, constructing new resources when needed with
+// the given factory function.
+func NewPool[T any](sem *Semaphore, factory func() (T, error)) *Pool[T] {
+	return &Pool[T]{
+		sem:     sem,
+		factory: factory,
+	}
+}
+
+// Get acquires a ticket from the pool's semaphore as if by calling AcquireContext,
+// and then returns an idle resource or, if there are none, a new one from the
+// factory. The returned release function must be called exactly once when the
+// resource is no longer in use, to return both it and the ticket to the pool. If
+// no ticket can be acquired, or the factory fails, Get returns the error and holds
+// no ticket. It is safe to call Get concurrently on a single Pool.
+func (p *Pool[T]) Get(ctx context.Context) (T, func(), error) {
+	var zero T
+
+	if err := p.sem.AcquireContext(ctx); err != nil {
+		return zero, nil, err
+	}
+
+	resource, ok := p.takeIdle()
+	if !ok {
+		var err error
+		resource, err = p.factory()
+		if err != nil {
+			p.sem.Release()
+			return zero, nil, err
+		}
+	}
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			p.putIdle(resource)
+			p.sem.Release()
+		})
+	}
+	return resource, release, nil
+}
+
+func (p *Pool[T]) takeIdle() (T, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	var resource T
+	if len(p.idle) == 0 {
+		return resource, false
+	}
+	resource = p.idle[len(p.idle)-1]
+	p.idle = p.idle[:len(p.idle)-1]
+	return resource, true
+}
+
+func (p *Pool[T]) putIdle(resource T) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.idle = append(p.idle, resource)
+}
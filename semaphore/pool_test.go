@@ -0,0 +1,62 @@
+//go:build go1.18
+// +build go1.18
+
+package semaphore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPool(t *testing.T) {
+	created := 0
+	pool := NewPool(New(2, 10*time.Millisecond), func() (int, error) {
+		created++
+		return created, nil
+	})
+
+	first, releaseFirst, err := pool.Get(context.Background())
+	if err != nil || first != 1 {
+		t.Error(first, err)
+	}
+	second, releaseSecond, err := pool.Get(context.Background())
+	if err != nil || second != 2 {
+		t.Error(second, err)
+	}
+
+	if _, _, err := pool.Get(context.Background()); !errors.Is(err, ErrNoTickets) {
+		t.Error(err)
+	}
+
+	releaseFirst()
+	releaseFirst()
+	reused, releaseReused, err := pool.Get(context.Background())
+	if err != nil || reused != 1 {
+		t.Error("expected the idle resource to be reused", reused, err)
+	}
+	if created != 2 {
+		t.Error("expected no new resources to be created")
+	}
+
+	releaseReused()
+	releaseSecond()
+	if !pool.sem.IsEmpty() {
+		t.Error("all tickets should have been released")
+	}
+}
+
+func TestPoolFactoryError(t *testing.T) {
+	errFactory := errors.New("errFactory")
+	pool := NewPool(New(1, 10*time.Millisecond), func() (string, error) {
+		return "", errFactory
+	})
+
+	if _, release, err := pool.Get(context.Background()); err != errFactory || release != nil {
+		t.Error(err)
+	}
+	if !pool.sem.IsEmpty() {
+		t.Error("ticket should not be held after a factory error")
+	}
+}
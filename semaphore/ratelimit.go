@@ -0,0 +1,120 @@
+package semaphore
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is the error returned by RateLimiter.Wait when no token is
+// available and none ever will be, because the limiter's rate is not positive or
+// its burst is less than one.
+var ErrRateLimited = errors.New("rate limit can never be satisfied")
+
+// RateLimiter implements the token-bucket rate limiting pattern. Where a
+// Semaphore limits how many operations may be in flight at once, a RateLimiter
+// limits how often they may start: it holds up to burst tokens, refilled
+// continuously at rate tokens per second, and every operation takes one. The two
+// are independent and can be combined, for example per key in a Registry.
+type RateLimiter struct {
+	rate  float64
+	burst int
+
+	lock   sync.Mutex
+	tokens float64   // may be negative while tokens are reserved by Wait
+	last   time.Time // when tokens was last refilled
+}
+
+// NewRateLimiter constructs a new RateLimiter that allows rate operations per
+// second on average, and up to burst at once. It starts with a full bucket of
+// burst tokens.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	return &RateLimiter{
+		rate:   rate,
+		burst:  burst,
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Rate returns the number of tokens added to the bucket every second, as given
+// to NewRateLimiter.
+func (l *RateLimiter) Rate() float64 {
+	return l.rate
+}
+
+// Burst returns the size of the bucket, as given to NewRateLimiter.
+func (l *RateLimiter) Burst() int {
+	return l.burst
+}
+
+// Allow takes a token if one is available right now, reporting whether it did
+// so. It never waits. It is safe to call Allow concurrently on a single
+// RateLimiter.
+func (l *RateLimiter) Allow() bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.refill(time.Now())
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// Wait takes a token, waiting until one is available if necessary. It returns
+// nil once it has a token, ctx.Err() if the context is done first (in which
+// case no token is taken), or ErrRateLimited without waiting if a token will
+// never be available. Callers are served in the order they call Wait. It is safe
+// to call Wait concurrently on a single RateLimiter.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l.lock.Lock()
+	l.refill(time.Now())
+	if l.tokens >= 1 {
+		l.tokens--
+		l.lock.Unlock()
+		return nil
+	}
+	if l.rate <= 0 || l.burst < 1 {
+		l.lock.Unlock()
+		return ErrRateLimited
+	}
+	// reserve the next token, so that later callers queue up behind this one
+	delay := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+	l.tokens--
+	l.lock.Unlock()
+
+	t := time.NewTimer(delay)
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		t.Stop()
+		l.lock.Lock()
+		l.refill(time.Now())
+		l.tokens++
+		if l.tokens > float64(l.burst) {
+			l.tokens = float64(l.burst)
+		}
+		l.lock.Unlock()
+		return ctx.Err()
+	}
+}
+
+// refill adds the tokens accrued since the last refill, up to burst. It must be
+// called with the lock held.
+func (l *RateLimiter) refill(now time.Time) {
+	if elapsed := now.Sub(l.last); elapsed > 0 && l.rate > 0 {
+		l.tokens += elapsed.Seconds() * l.rate
+		if l.tokens > float64(l.burst) {
+			l.tokens = float64(l.burst)
+		}
+	}
+	l.last = now
+}
@@ -0,0 +1,73 @@
+package semaphore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	l := NewRateLimiter(100, 2)
+
+	if !l.Allow() || !l.Allow() {
+		t.Error("the initial burst should be allowed")
+	}
+	if l.Allow() {
+		t.Error("the bucket should be empty")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if !l.Allow() {
+		t.Error("the bucket should have refilled")
+	}
+	if l.Rate() != 100 || l.Burst() != 2 {
+		t.Error("wrong configuration", l.Rate(), l.Burst())
+	}
+}
+
+func TestRateLimiterWait(t *testing.T) {
+	l := NewRateLimiter(50, 1)
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := l.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the first token is immediate and the next two take 20ms each
+	if elapsed := time.Since(start); elapsed < 35*time.Millisecond || elapsed >= 1*time.Second {
+		t.Error("waited the wrong amount of time", elapsed)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := l.Wait(cancelled); err != context.Canceled {
+		t.Error(err)
+	}
+
+	short, cancel := context.WithTimeout(ctx, time.Millisecond)
+	defer cancel()
+	if err := l.Wait(short); err != context.DeadlineExceeded {
+		t.Error(err)
+	}
+	// the abandoned reservation was given back
+	time.Sleep(40 * time.Millisecond)
+	if !l.Allow() {
+		t.Error("a token should be available")
+	}
+}
+
+func TestRateLimiterNeverSatisfied(t *testing.T) {
+	if err := NewRateLimiter(10, 0).Wait(context.Background()); err != ErrRateLimited {
+		t.Error(err)
+	}
+
+	l := NewRateLimiter(0, 1)
+	if err := l.Wait(context.Background()); err != nil {
+		t.Error(err)
+	}
+	if err := l.Wait(context.Background()); err != ErrRateLimited {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,203 @@
+package semaphore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrUnknownKey is the error returned by Registry.AcquireKeys and
+// Registry.WaitKey when asked for a key that has no semaphore or rate limiter
+// registered, respectively. It is returned wrapped with the key, so check for it
+// with errors.Is.
+var ErrUnknownKey = errors.New("nothing registered for key")
+
+// Registry is a concurrent set of semaphores and rate limiters keyed by name, for
+// when the set of things to limit is only known at runtime, such as one
+// semaphore per tenant. A key may have a semaphore, a rate limiter, or both,
+// limiting how many of its operations run at once and how often they start
+// respectively; the two are independent but share the key's lifecycle in the
+// registry. The zero value is an empty registry ready to use. A Registry must
+// not be copied after first use.
+type Registry struct {
+	lock       sync.Mutex
+	semaphores map[string]*Semaphore
+	limiters   map[string]*RateLimiter
+}
+
+// GetOrCreate returns the semaphore registered under key, first constructing it
+// as if by New(tickets, timeout) and registering it if there is none. Even when
+// called concurrently for the same new key, exactly one semaphore is constructed
+// and every caller receives it. The ticket-count and timeout are ignored if the
+// semaphore already exists. It is safe to call GetOrCreate concurrently with all
+// other methods on a single Registry.
+func (r *Registry) GetOrCreate(key string, tickets int, timeout time.Duration) *Semaphore {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	sem, ok := r.semaphores[key]
+	if !ok {
+		if r.semaphores == nil {
+			r.semaphores = make(map[string]*Semaphore)
+		}
+		sem = New(tickets, timeout)
+		r.semaphores[key] = sem
+	}
+	return sem
+}
+
+// GetOrCreateLimiter returns the rate limiter registered under key, first
+// constructing it as if by NewRateLimiter(rate, burst) and registering it if
+// there is none, with the same guarantees as GetOrCreate. The rate and burst are
+// ignored if the rate limiter already exists. It is safe to call
+// GetOrCreateLimiter concurrently with all other methods on a single Registry.
+func (r *Registry) GetOrCreateLimiter(key string, rate float64, burst int) *RateLimiter {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	limiter, ok := r.limiters[key]
+	if !ok {
+		if r.limiters == nil {
+			r.limiters = make(map[string]*RateLimiter)
+		}
+		limiter = NewRateLimiter(rate, burst)
+		r.limiters[key] = limiter
+	}
+	return limiter
+}
+
+// Delete removes the semaphore and the rate limiter registered under key, if
+// any. Callers that already have them may continue to use them, but a later
+// GetOrCreate or GetOrCreateLimiter for the same key constructs a new one. It is
+// safe to call Delete concurrently with all other methods on a single Registry.
+func (r *Registry) Delete(key string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	delete(r.semaphores, key)
+	delete(r.limiters, key)
+}
+
+// Range calls f for each registered semaphore, in no particular order, until f
+// returns false. It iterates over a snapshot taken when it is called, so f may
+// itself use the registry, for example to delete the semaphore it was given. It
+// is safe to call Range concurrently with all other methods on a single
+// Registry.
+func (r *Registry) Range(f func(key string, s *Semaphore) bool) {
+	r.lock.Lock()
+	keys := make([]string, 0, len(r.semaphores))
+	sems := make([]*Semaphore, 0, len(r.semaphores))
+	for key, sem := range r.semaphores {
+		keys = append(keys, key)
+		sems = append(sems, sem)
+	}
+	r.lock.Unlock()
+
+	for i := range keys {
+		if !f(keys[i], sems[i]) {
+			return
+		}
+	}
+}
+
+// Stats returns the Stats of every registered semaphore, keyed by the key it is
+// registered under. Each semaphore's Stats is a consistent snapshot as described
+// by Semaphore.Stats, but they are taken one after another, so the map as a
+// whole does not describe a single instant. The registry's lock is only held
+// while listing the semaphores, not while collecting their Stats, so GetOrCreate
+// and Delete are not held up; a semaphore they add or remove meanwhile may or may
+// not be included. It is safe to call Stats concurrently with all other methods
+// on a single Registry.
+func (r *Registry) Stats() map[string]Stats {
+	stats := make(map[string]Stats)
+	r.Range(func(key string, s *Semaphore) bool {
+		stats[key] = s.Stats()
+		return true
+	})
+	return stats
+}
+
+// RangeLimiters calls f for each registered rate limiter, like Range does for
+// semaphores. It is safe to call RangeLimiters concurrently with all other
+// methods on a single Registry.
+func (r *Registry) RangeLimiters(f func(key string, l *RateLimiter) bool) {
+	r.lock.Lock()
+	keys := make([]string, 0, len(r.limiters))
+	limiters := make([]*RateLimiter, 0, len(r.limiters))
+	for key, limiter := range r.limiters {
+		keys = append(keys, key)
+		limiters = append(limiters, limiter)
+	}
+	r.lock.Unlock()
+
+	for i := range keys {
+		if !f(keys[i], limiters[i]) {
+			return
+		}
+	}
+}
+
+// AllowKey takes a token from the rate limiter registered under key, as if by
+// calling its Allow method, reporting whether it did so. It returns false if no
+// rate limiter is registered under key, since the registry has no rate to create
+// one with. It is safe to call AllowKey concurrently with all other methods on a
+// single Registry.
+func (r *Registry) AllowKey(key string) bool {
+	limiter := r.limiter(key)
+	return limiter != nil && limiter.Allow()
+}
+
+// WaitKey takes a token from the rate limiter registered under key, waiting for
+// one as if by calling its Wait method. If no rate limiter is registered under
+// key it returns an error wrapping ErrUnknownKey without waiting. It is safe to
+// call WaitKey concurrently with all other methods on a single Registry.
+func (r *Registry) WaitKey(ctx context.Context, key string) error {
+	limiter := r.limiter(key)
+	if limiter == nil {
+		return fmt.Errorf("%w %q", ErrUnknownKey, key)
+	}
+	return limiter.Wait(ctx)
+}
+
+func (r *Registry) limiter(key string) *RateLimiter {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.limiters[key]
+}
+
+// AcquireKeys acquires a ticket from each of the semaphores registered under the
+// given keys, all or nothing, like AcquireAll. The semaphores are always
+// acquired in sorted key order no matter what order the keys are passed in, so
+// concurrent calls with overlapping sets of keys cannot end up waiting on each
+// other. (Mixing AcquireKeys and AcquireAll on the same semaphores gives no such
+// guarantee, since AcquireAll uses a different order.) Keys must already be
+// registered with GetOrCreate: if any is not, AcquireKeys returns an error
+// wrapping ErrUnknownKey without acquiring anything, since the registry has no
+// ticket-count or timeout to create it with. If any acquisition fails, every
+// ticket already acquired is released and the error is returned. Otherwise the
+// returned function releases all the tickets; only its first call has any
+// effect. Passing the same key more than once acquires that many tickets from
+// its semaphore.
+func (r *Registry) AcquireKeys(ctx context.Context, keys ...string) (func(), error) {
+	sorted := make([]string, len(keys))
+	copy(sorted, keys)
+	sort.Strings(sorted)
+
+	ordered := make([]*Semaphore, len(sorted))
+	r.lock.Lock()
+	for i, key := range sorted {
+		sem, ok := r.semaphores[key]
+		if !ok {
+			r.lock.Unlock()
+			return nil, fmt.Errorf("%w %q", ErrUnknownKey, key)
+		}
+		ordered[i] = sem
+	}
+	r.lock.Unlock()
+
+	return acquireInOrder(ctx, ordered)
+}
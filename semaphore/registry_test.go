@@ -0,0 +1,213 @@
+package semaphore
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRegistryGetOrCreate(t *testing.T) {
+	var r Registry
+
+	sems := make([]*Semaphore, 10)
+	var wg sync.WaitGroup
+	for i := range sems {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sems[i] = r.GetOrCreate("tenant", 2, time.Second)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, sem := range sems {
+		if sem != sems[0] {
+			t.Fatal("concurrent GetOrCreate should return a single semaphore")
+		}
+	}
+	if sems[0].Cap() != 2 || sems[0].Timeout() != time.Second {
+		t.Error("semaphore not constructed as requested")
+	}
+	if r.GetOrCreate("tenant", 5, 0) != sems[0] {
+		t.Error("existing semaphore should be returned")
+	}
+	if r.GetOrCreate("other", 1, 0) == sems[0] {
+		t.Error("different keys should get different semaphores")
+	}
+}
+
+func TestRegistryDeleteAndRange(t *testing.T) {
+	var r Registry
+	r.Range(func(string, *Semaphore) bool {
+		t.Error("empty registry should have nothing to range over")
+		return true
+	})
+	r.Delete("missing")
+
+	a := r.GetOrCreate("a", 1, 0)
+	r.GetOrCreate("b", 1, 0)
+	r.GetOrCreate("c", 1, 0)
+
+	seen := make(map[string]bool)
+	r.Range(func(key string, s *Semaphore) bool {
+		seen[key] = true
+		r.Delete(key)
+		return true
+	})
+	if len(seen) != 3 {
+		t.Error(seen)
+	}
+
+	count := 0
+	r.Range(func(string, *Semaphore) bool {
+		count++
+		return true
+	})
+	if count != 0 {
+		t.Error("every key should have been deleted")
+	}
+	if r.GetOrCreate("a", 1, 0) == a {
+		t.Error("deleted key should get a new semaphore")
+	}
+
+	r.GetOrCreate("b", 1, 0)
+	count = 0
+	r.Range(func(string, *Semaphore) bool {
+		count++
+		return false
+	})
+	if count != 1 {
+		t.Error("Range should stop when f returns false")
+	}
+}
+
+func TestRegistryAcquireKeys(t *testing.T) {
+	var r Registry
+	a := r.GetOrCreate("a", 1, time.Second)
+	b := r.GetOrCreate("b", 1, time.Second)
+	c := r.GetOrCreate("c", 1, 10*time.Millisecond)
+
+	release, err := r.AcquireKeys(context.Background(), "b", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.InUse() != 1 || b.InUse() != 1 || c.InUse() != 0 {
+		t.Error("wrong tickets held")
+	}
+	release()
+	release()
+	if !a.IsEmpty() || !b.IsEmpty() {
+		t.Error("tickets should have been released once")
+	}
+
+	// nothing is acquired if any key is unknown
+	if _, err := r.AcquireKeys(context.Background(), "a", "missing"); !errors.Is(err, ErrUnknownKey) {
+		t.Error(err)
+	}
+	if !a.IsEmpty() {
+		t.Error("nothing should be held after an unknown key")
+	}
+
+	// a failure rolls back what was already acquired
+	c.Acquire()
+	if _, err := r.AcquireKeys(context.Background(), "c", "a", "b"); !errors.Is(err, ErrNoTickets) {
+		t.Error(err)
+	}
+	if !a.IsEmpty() || !b.IsEmpty() {
+		t.Error("partial acquisitions should have been rolled back")
+	}
+	c.Release()
+
+	// opposite orders cannot deadlock
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		for _, keys := range [][]string{{"a", "b"}, {"b", "a"}} {
+			go func(keys []string) {
+				defer wg.Done()
+				release, err := r.AcquireKeys(context.Background(), keys...)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				release()
+			}(keys)
+		}
+	}
+	wg.Wait()
+}
+
+func TestRegistryRateLimiters(t *testing.T) {
+	var r Registry
+
+	if r.AllowKey("tenant") {
+		t.Error("unknown keys should not be allowed")
+	}
+	if err := r.WaitKey(context.Background(), "tenant"); !errors.Is(err, ErrUnknownKey) {
+		t.Error(err)
+	}
+
+	limiter := r.GetOrCreateLimiter("tenant", 10, 1)
+	if r.GetOrCreateLimiter("tenant", 100, 5) != limiter {
+		t.Error("existing rate limiter should be returned")
+	}
+	if !r.AllowKey("tenant") {
+		t.Error("the first token should be allowed")
+	}
+	if r.AllowKey("tenant") {
+		t.Error("the bucket should be empty")
+	}
+	if err := r.WaitKey(context.Background(), "tenant"); err != nil {
+		t.Error(err)
+	}
+
+	// rate limiters and semaphores share the key but are independent
+	sem := r.GetOrCreate("tenant", 1, 0)
+	if !sem.IsEmpty() {
+		t.Error("the semaphore should be unaffected by the rate limiter")
+	}
+
+	count := 0
+	r.RangeLimiters(func(key string, l *RateLimiter) bool {
+		if key != "tenant" || l != limiter {
+			t.Error("unexpected rate limiter", key)
+		}
+		count++
+		return true
+	})
+	if count != 1 {
+		t.Error("expected one rate limiter, got", count)
+	}
+
+	r.Delete("tenant")
+	if r.AllowKey("tenant") {
+		t.Error("deleted keys should not be allowed")
+	}
+	if r.GetOrCreate("tenant", 1, 0) == sem {
+		t.Error("the semaphore should have been deleted too")
+	}
+}
+
+func TestRegistryStats(t *testing.T) {
+	var r Registry
+
+	if stats := r.Stats(); len(stats) != 0 {
+		t.Error("expected no stats, got", stats)
+	}
+
+	r.GetOrCreate("a", 2, 0).Acquire()
+	r.GetOrCreate("b", 3, 0)
+
+	stats := r.Stats()
+	if len(stats) != 2 {
+		t.Fatal("expected stats for two semaphores, got", stats)
+	}
+	if a := stats["a"]; a.Capacity != 2 || a.InUse != 1 || a.TotalAcquired != 1 {
+		t.Errorf("wrong stats for a: %+v", a)
+	}
+	if b := stats["b"]; b.Capacity != 3 || b.InUse != 0 {
+		t.Errorf("wrong stats for b: %+v", b)
+	}
+}
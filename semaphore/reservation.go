@@ -0,0 +1,53 @@
+package semaphore
+
+import "sync/atomic"
+
+// Reservation is a ticket acquired from a Semaphore speculatively, for work that
+// first has some cheap preconditions to check. Once they have been checked the
+// reservation is either committed, turning it into an ordinary held ticket, or
+// aborted, returning the ticket to the semaphore straight away.
+type Reservation struct {
+	sem   *Semaphore
+	state int32 // accessed atomically; one of the reservation states below
+}
+
+const (
+	reserved int32 = iota
+	committed
+	aborted
+)
+
+// Reserve tries to acquire a ticket from the semaphore as if by calling Acquire,
+// returning it as a Reservation that must then be either committed or aborted.
+// It is safe to call Reserve concurrently on a single Semaphore.
+func (s *Semaphore) Reserve() (*Reservation, error) {
+	if err := s.Acquire(); err != nil {
+		return nil, err
+	}
+	return &Reservation{sem: s}, nil
+}
+
+// Commit turns the reservation into an ordinary held ticket, which must later be
+// released to the semaphore with Release like any other. Commit and Abort are
+// mutually exclusive: only the first call to either has any effect, so once a
+// reservation has been aborted Commit does nothing and the ticket must not be
+// released. It is safe to call Commit concurrently with Abort.
+func (r *Reservation) Commit() {
+	atomic.CompareAndSwapInt32(&r.state, reserved, committed)
+}
+
+// Abort returns the reserved ticket to the semaphore. Commit and Abort are
+// mutually exclusive: only the first call to either has any effect, so once a
+// reservation has been committed Abort does nothing and the ticket must still be
+// released. It is safe to call Abort concurrently with Commit.
+func (r *Reservation) Abort() {
+	if atomic.CompareAndSwapInt32(&r.state, reserved, aborted) {
+		r.sem.Release()
+	}
+}
+
+// Committed reports whether Commit took effect, in which case the ticket is
+// held until it is released.
+func (r *Reservation) Committed() bool {
+	return atomic.LoadInt32(&r.state) == committed
+}
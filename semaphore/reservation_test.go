@@ -0,0 +1,64 @@
+package semaphore
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSemaphoreReserve(t *testing.T) {
+	sem := New(1, 10*time.Millisecond)
+
+	r, err := sem.Reserve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sem.Reserve(); !errors.Is(err, ErrNoTickets) {
+		t.Error(err)
+	}
+
+	r.Abort()
+	r.Abort()
+	r.Commit()
+	if !sem.IsEmpty() || r.Committed() {
+		t.Error("an aborted reservation should return its ticket exactly once")
+	}
+
+	r, _ = sem.Reserve()
+	r.Commit()
+	r.Abort()
+	if sem.InUse() != 1 || !r.Committed() {
+		t.Error("a committed reservation should keep its ticket")
+	}
+	sem.Release()
+}
+
+func TestSemaphoreReserveRace(t *testing.T) {
+	sem := New(1, 0)
+
+	for i := 0; i < 100; i++ {
+		r, err := sem.Reserve()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			r.Commit()
+		}()
+		go func() {
+			defer wg.Done()
+			r.Abort()
+		}()
+		wg.Wait()
+
+		if r.Committed() {
+			sem.Release()
+		}
+		if !sem.IsEmpty() {
+			t.Fatal("the ticket should be released exactly once")
+		}
+	}
+}
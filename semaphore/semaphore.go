@@ -2,56 +2,1301 @@
 package semaphore
 
 import (
+	"container/list"
+	"context"
 	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// ErrUnavailable is wrapped by both ErrNoTickets and ErrBudgetExhausted, so
+// errors.Is(err, ErrUnavailable) reports whether a ticket could not be acquired
+// for lack of time, whether that was a single attempt timing out or a retrying
+// caller giving up altogether.
+var ErrUnavailable = errors.New("semaphore ticket unavailable")
+
 // ErrNoTickets is the error returned by Acquire when it could not acquire
-// a ticket from the semaphore within the configured timeout.
-var ErrNoTickets = errors.New("could not acquire semaphore ticket")
+// a ticket from the semaphore within the configured timeout. The error is
+// returned wrapped in a TimeoutError, so check for it with errors.Is. It wraps
+// ErrUnavailable.
+var ErrNoTickets error = &unavailableError{"could not acquire semaphore ticket"}
+
+// ErrTooManyTickets is the error returned by AcquireN when asked for more
+// tickets than the semaphore could ever hand out at once.
+var ErrTooManyTickets = errors.New("requested more tickets than the semaphore holds")
+
+// ErrInvalidTickets is the error returned by Resize when given a negative
+// ticket-count.
+var ErrInvalidTickets = errors.New("semaphore ticket-count must not be negative")
+
+// ErrNotAcquired is the error returned by TryRelease when there is no held
+// ticket to release.
+var ErrNotAcquired = errors.New("semaphore ticket was not acquired")
+
+// ErrTooManyWaiters is the error returned by the acquire methods when no ticket
+// is available and the limit set by WithMaxWaiters has already been reached.
+var ErrTooManyWaiters = errors.New("too many callers waiting for semaphore tickets")
+
+// ErrClosed is the error returned by the acquire methods once the semaphore
+// has been closed, and by Close if it was already closed. The error is returned
+// wrapped in a ClosedError, so check for it with errors.Is.
+var ErrClosed = errors.New("semaphore is closed")
+
+// ErrInterrupted is the error returned by AcquireWithStop when its stop channel
+// is closed before a ticket could be acquired.
+var ErrInterrupted = errors.New("semaphore acquisition interrupted")
+
+// TimeoutError is the error returned by the acquire methods when they could not
+// acquire tickets from the semaphore within the timeout. It wraps ErrNoTickets,
+// so errors.Is(err, ErrNoTickets) reports whether an error is a TimeoutError.
+type TimeoutError struct {
+	// Name is the name of the semaphore, as set by WithName.
+	Name string
+	// Timeout is how long the acquisition was allowed to wait.
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s%s within %v", namePrefix(e.Name), ErrNoTickets, e.Timeout)
+}
+
+// Unwrap returns ErrNoTickets.
+func (e *TimeoutError) Unwrap() error {
+	return ErrNoTickets
+}
+
+// ClosedError is the error returned by the acquire methods, and by Close, once
+// the semaphore has been closed. It wraps ErrClosed, so errors.Is(err, ErrClosed)
+// reports whether an error is a ClosedError.
+type ClosedError struct {
+	// Name is the name of the semaphore, as set by WithName.
+	Name string
+}
+
+func (e *ClosedError) Error() string {
+	return namePrefix(e.Name) + ErrClosed.Error()
+}
+
+// Unwrap returns ErrClosed.
+func (e *ClosedError) Unwrap() error {
+	return ErrClosed
+}
+
+// unavailableError is the type of the sentinel errors that wrap ErrUnavailable.
+type unavailableError struct {
+	msg string
+}
+
+func (e *unavailableError) Error() string {
+	return e.msg
+}
+
+func (e *unavailableError) Unwrap() error {
+	return ErrUnavailable
+}
+
+func namePrefix(name string) string {
+	if name == "" {
+		return ""
+	}
+	return fmt.Sprintf("semaphore %q: ", name)
+}
+
+// errDone is returned internally by acquire when its done channel is closed;
+// callers translate it into the appropriate public error.
+var errDone = errors.New("semaphore acquisition interrupted")
+
+// nextID is used to give every Semaphore a unique id.
+var nextID uint64
 
 // Semaphore implements the semaphore resiliency pattern
 type Semaphore struct {
-	sem     chan struct{}
-	timeout time.Duration
+	// accessed atomically, kept first for 64-bit alignment on 32-bit platforms
+	waiting   int64
+	acquired  uint64
+	timeouts  uint64
+	cancels   uint64
+	rejects   uint64
+	refusals  uint64
+	timeout   int64 // a time.Duration
+	tickets   int64 // only changed with the lock held
+	held      int64 // only changed by claim and unclaim
+	releasing int64 // releases in progress, only counted for WithInvariantChecks
+	slow      int32 // non-zero while the fast paths must not be used, see updateSlow
+
+	id           uint64 // orders semaphores for AcquireAll
+	name         string
+	timeoutFunc  func() time.Duration // overrides timeout if set
+	jitter       float64              // fraction of timeout to randomize by
+	workTimeout  time.Duration        // bounds the work run by DoContext if positive
+	rand         *rand.Rand           // guarded by randLock
+	randLock     sync.Mutex
+	fair         bool
+	maxWaiters   int
+	policy       Policy
+	waiterStacks bool
+	invariants   bool       // see WithInvariantChecks
+	clock        clock      // nil for the real clock
+	latency      *histogram // nil unless enabled
+	tracer       Tracer     // nil for no tracing
+
+	onAcquire func(waited time.Duration)
+	onWait    func()
+	onRelease func()
+	onTimeout func(waited time.Duration)
+	onClose   func()          // only used internally, by WithLogger
+	onDrain   func(err error) // only used internally, by WithLogger
+
+	lock    sync.Mutex
+	waiters list.List     // of *waiter
+	idle    chan struct{} // closed and cleared once held drops to zero
+	closed  bool
+	paused  bool
+	tracked map[*Ticket]struct{} // outstanding tickets, if leak tracking is enabled
+
+	events    chan Event // nil until Notify is called
+	saturated bool       // as last reported on events
+
+	healthGrace       time.Duration
+	contendedSince    time.Time // zero unless every ticket is held and callers are waiting
+	shedWhenUnhealthy bool
+	shedding          bool // shedding load until a ticket is free again
+}
+
+type waiter struct {
+	n        int
+	priority int
+	ready    chan struct{} // closed once the tickets have been handed over
+	err      error         // set before ready is closed if the wait failed
+	since    time.Time     // when the waiter was enqueued
+	stack    []byte        // where the waiter is blocked, if enabled
 }
 
 // New constructs a new Semaphore with the given ticket-count
-// and timeout.
+// and timeout. It is equivalent to calling NewWithOptions with
+// WithTimeout(timeout). A semaphore with a ticket-count of zero rejects every
+// acquisition immediately with ErrNoTickets, without waiting for the timeout;
+// use NewChecked to treat a zero ticket-count as an error instead.
 func New(tickets int, timeout time.Duration) *Semaphore {
 	return &Semaphore{
-		sem:     make(chan struct{}, tickets),
-		timeout: timeout,
+		id:          atomic.AddUint64(&nextID, 1),
+		tickets:     int64(tickets),
+		timeout:     int64(timeout),
+		healthGrace: DefaultHealthGracePeriod,
+	}
+}
+
+// Name returns the name of the semaphore as set by WithName, or the empty
+// string if it has none.
+func (s *Semaphore) Name() string {
+	return s.name
+}
+
+// Timeout returns how long the semaphore waits for a ticket if none are currently
+// available, as given to New or most recently to SetTimeout. If the semaphore
+// was constructed with WithTimeoutFunc then it instead returns the result of
+// calling that function.
+func (s *Semaphore) Timeout() time.Duration {
+	if s.timeoutFunc != nil {
+		return s.timeoutFunc()
 	}
+	return time.Duration(atomic.LoadInt64(&s.timeout))
+}
+
+// SetTimeout changes how long the semaphore waits for a ticket if none are
+// currently available. Only acquisitions that start after SetTimeout returns use
+// the new timeout; any already waiting keep the deadline they started with. It
+// has no effect while a WithTimeoutFunc is in use. It is safe to call SetTimeout
+// concurrently with all other methods on a single Semaphore.
+func (s *Semaphore) SetTimeout(timeout time.Duration) {
+	atomic.StoreInt64(&s.timeout, int64(timeout))
 }
 
 // Acquire tries to acquire a ticket from the semaphore. If it can, it returns nil.
-// If it cannot after "timeout" amount of time, it returns ErrNoTickets. It is
-// safe to call Acquire concurrently on a single Semaphore.
+// If it cannot after "timeout" amount of time, it returns ErrNoTickets. A timer
+// is only started if the ticket is not immediately available, so the
+// uncontended case neither allocates nor takes a lock. It is safe to call
+// Acquire concurrently on a single Semaphore.
 func (s *Semaphore) Acquire() error {
-	timer := time.NewTimer(s.timeout)
-	select {
-	case s.sem <- struct{}{}:
-		if !timer.Stop() {
-			<-timer.C
+	return s.acquire(1, 0, timeoutDefault, nil)
+}
+
+// AcquireContext tries to acquire a ticket from the semaphore, giving up when
+// either the given context is done or "timeout" amount of time has passed,
+// whichever happens first. If it acquires a ticket it returns nil. If the
+// context is done first it returns ctx.Err(), and if the timeout expires first
+// it returns ErrNoTickets, so callers can tell cancellation and exhaustion apart.
+// When the context has a deadline that falls no later than the timeout would,
+// the context's deadline is the one that applies, so a tie is always reported
+// as context.DeadlineExceeded. The acquisition is reported to the semaphore's
+// Tracer, if it was given one with WithTracer. To pass how long the call waited
+// on to downstream code, see ContextWithWaitDuration. It is safe to call
+// AcquireContext concurrently on a single Semaphore.
+func (s *Semaphore) AcquireContext(ctx context.Context) error {
+	return s.acquireContext(ctx, 1, nil)
+}
+
+// AcquireWithStop tries to acquire a ticket from the semaphore like Acquire, but
+// gives up and returns ErrInterrupted if the given stop channel is closed first,
+// for callers that thread a done channel rather than a context.Context. The
+// configured timeout still applies, and if it expires first AcquireWithStop
+// returns ErrNoTickets as usual. A nil stop channel is never closed, making
+// AcquireWithStop equivalent to Acquire. It is safe to call AcquireWithStop
+// concurrently on a single Semaphore.
+func (s *Semaphore) AcquireWithStop(stop <-chan struct{}) error {
+	if err := s.acquire(1, 0, timeoutDefault, stop); err != errDone {
+		return err
+	}
+	return ErrInterrupted
+}
+
+// AcquirePos tries to acquire a ticket from the semaphore like AcquireContext,
+// and also reports the caller's position in the queue at the moment it started
+// waiting, for showing queued callers how many others are ahead of them. The
+// position is 1 for the caller at the front of the queue, 0 if a ticket was
+// acquired without waiting, and -1 if acquisition failed without waiting. It is
+// a point-in-time estimate: callers ahead may give up, and callers with a higher
+// priority may join ahead. It is only meaningful in fair mode (see
+// WithFairness), since otherwise waiters can be overtaken at any time; without
+// fairness the position of a caller that had to wait is always -1. It is safe to
+// call AcquirePos concurrently on a single Semaphore.
+func (s *Semaphore) AcquirePos(ctx context.Context) (pos int, err error) {
+	pos = -1
+	err = s.acquireContext(ctx, 1, &pos)
+	return pos, err
+}
+
+// acquireContext is the shared implementation of the methods that acquire n
+// tickets until a context is done, reporting the acquisition to the Tracer.
+func (s *Semaphore) acquireContext(ctx context.Context, n int, pos *int) error {
+	if s.tracer == nil {
+		return s.acquireUntil(ctx, n, pos)
+	}
+
+	ctx, finish := s.tracer.StartAcquire(ctx)
+	err := s.acquireUntil(ctx, n, pos)
+	finish(traceOutcome(err))
+	return err
+}
+
+func (s *Semaphore) acquireUntil(ctx context.Context, n int, pos *int) error {
+	deadline, _ := ctx.Deadline()
+	if err := s.acquireWait(n, 0, timeoutDefault, deadline, 0, nil, ctx.Done(), pos); err != errDone {
+		return err
+	}
+	return ctx.Err()
+}
+
+// AcquireWithPriority tries to acquire a ticket from the semaphore like Acquire,
+// but if it has to wait then it is handed a ticket ahead of any waiting callers
+// with a lower priority. Callers with the same priority are served in the order
+// they started waiting, and all the other acquire methods wait at priority zero.
+// Priority only orders the wait queue; it does not extend the timeout, so under
+// sustained contention a low-priority caller that keeps being overtaken will
+// eventually fail with ErrNoTickets. It is safe to call AcquireWithPriority
+// concurrently on a single Semaphore.
+func (s *Semaphore) AcquireWithPriority(priority int) error {
+	return s.acquire(1, priority, timeoutDefault, nil)
+}
+
+// AcquireChan tries to acquire a ticket from the semaphore as if by calling
+// Acquire, but does so in the background and immediately returns a channel on
+// which the result will be delivered, so that the acquisition can be used in a
+// select statement alongside other channels. Exactly one value is sent on the
+// channel, and sending it never blocks. Since the ticket is acquired whether or
+// not anyone is listening, the caller must always receive from the channel
+// eventually and, if the value received is nil, release the ticket; otherwise
+// the ticket is leaked. It is safe to call AcquireChan concurrently on a single
+// Semaphore.
+func (s *Semaphore) AcquireChan() <-chan error {
+	result := make(chan error, 1)
+	go func() {
+		result <- s.Acquire()
+	}()
+	return result
+}
+
+// AcquireTimeout tries to acquire a ticket from the semaphore like Acquire, but
+// waits up to the given timeout instead of the configured one. A timeout of zero
+// only tries once without waiting, and a negative timeout waits for as long as it
+// takes to acquire a ticket. It is safe to call AcquireTimeout concurrently on a
+// single Semaphore.
+func (s *Semaphore) AcquireTimeout(timeout time.Duration) error {
+	return s.acquire(1, 0, timeout, nil)
+}
+
+// AcquireSoftHard tries to acquire a ticket from the semaphore like
+// AcquireTimeout with a timeout of hard, but if it is still waiting once the soft
+// threshold has elapsed it calls onSoft, exactly once, and then carries on
+// waiting until hard before giving up with ErrNoTickets. This allows slow
+// queueing to be logged or alerted on without giving up early. onSoft is called
+// on the goroutine that is waiting; it is never called if a ticket is acquired
+// before soft has elapsed, or if soft is not shorter than a non-negative hard.
+// It is safe to call AcquireSoftHard concurrently on a single Semaphore.
+func (s *Semaphore) AcquireSoftHard(soft, hard time.Duration, onSoft func()) error {
+	return s.acquireWait(1, 0, hard, time.Time{}, soft, onSoft, nil, nil)
+}
+
+// TryAcquire tries to acquire a ticket from the semaphore without waiting. It
+// returns true if a ticket was acquired, and false if none were available or the
+// semaphore has been closed. It is safe to call TryAcquire concurrently on a
+// single Semaphore.
+func (s *Semaphore) TryAcquire() bool {
+	if !s.tryAcquire(1) {
+		return false
+	}
+	s.recordAcquire(0)
+	return true
+}
+
+// TryAcquireContext tries to acquire a ticket from the semaphore without
+// waiting, like TryAcquire, unless the given context is already done, in which
+// case it returns ctx.Err() without trying. It returns true with a nil error if a
+// ticket was acquired, false with a nil error if none were available, and false
+// with an error wrapping ErrClosed if the semaphore has been closed, or ErrPaused
+// if it has been paused. Like TryAcquire it does not allocate. It is safe to call
+// TryAcquireContext concurrently on a single Semaphore.
+func (s *Semaphore) TryAcquireContext(ctx context.Context) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		s.recordCancel()
+		return false, err
+	}
+
+	if !s.fastAcquire(1) {
+		s.lock.Lock()
+		if s.closed {
+			s.lock.Unlock()
+			s.recordRefusal()
+			return false, &ClosedError{Name: s.name}
 		}
+		if s.paused {
+			s.lock.Unlock()
+			s.recordRefusal()
+			return false, ErrPaused
+		}
+		if !s.take(1) {
+			s.lock.Unlock()
+			s.recordMiss()
+			return false, nil
+		}
+		s.checkSaturation()
+		s.lock.Unlock()
+	}
 
+	s.recordAcquire(0)
+	return true, nil
+}
+
+// AcquireN tries to acquire n tickets from the semaphore. If it can acquire all
+// of them within "timeout" amount of time, it returns nil. Otherwise it returns
+// ErrNoTickets without holding any of them, so a failed call never leaves the
+// semaphore holding a partial set. If n is greater than the semaphore's
+// ticket-count it returns ErrTooManyTickets immediately, since waiting could
+// never succeed; the exception is a ticket-count of zero, for which every
+// acquisition fails immediately with ErrNoTickets as described by Resize. Once
+// the semaphore has been closed it fails with ErrClosed for every n, including
+// zero. It is safe to call AcquireN concurrently on a single Semaphore.
+func (s *Semaphore) AcquireN(n int) error {
+	if n <= 0 {
+		if s.isClosed() {
+			s.recordRefusal()
+			return &ClosedError{Name: s.name}
+		}
 		return nil
-	case <-timer.C:
-		return ErrNoTickets
 	}
+	return s.acquire(n, 0, timeoutDefault, nil)
+}
+
+// TryAcquireN tries to acquire n tickets from the semaphore without waiting. It
+// acquires either all of them, returning true, or none of them, returning false;
+// it never holds a partial set. Once the semaphore has been closed it returns
+// false for every n, including zero. It is safe to call TryAcquireN
+// concurrently on a single Semaphore.
+func (s *Semaphore) TryAcquireN(n int) bool {
+	if n <= 0 {
+		if s.isClosed() {
+			s.recordRefusal()
+			return false
+		}
+		return true
+	}
+	if !s.tryAcquire(n) {
+		return false
+	}
+	s.recordAcquire(0)
+	return true
 }
 
 // Release releases an acquired ticket back to the semaphore. It is safe to call
 // Release concurrently on a single Semaphore. It is an error to call Release on
-// a Semaphore from which you have not first acquired a ticket.
+// a Semaphore from which you have not first acquired a ticket, and doing so
+// panics; use TryRelease if you need to detect that case instead.
 func (s *Semaphore) Release() {
-	<-s.sem
+	s.ReleaseN(1)
+}
+
+// TryRelease releases an acquired ticket back to the semaphore like Release, but
+// returns ErrNotAcquired rather than panicking if no tickets are currently held.
+// It is safe to call TryRelease concurrently on a single Semaphore.
+func (s *Semaphore) TryRelease() error {
+	if !s.release(1) {
+		return ErrNotAcquired
+	}
+	s.recordRelease()
+	return nil
+}
+
+// ReleaseN releases n acquired tickets back to the semaphore, as if by calling
+// Release n times. It is safe to call ReleaseN concurrently on a single
+// Semaphore. It is an error to call ReleaseN on a Semaphore from which you have
+// not first acquired at least n tickets, and doing so panics. Releasing zero or
+// fewer tickets does nothing.
+func (s *Semaphore) ReleaseN(n int) {
+	if n <= 0 {
+		return
+	}
+	if !s.release(n) {
+		panic("semaphore: released more tickets than were held")
+	}
+	s.recordRelease()
+}
+
+// ReleaseAll releases up to n held tickets back to the semaphore in one call, for
+// unwinding a partially-completed batch of acquisitions on an error path. Unlike
+// ReleaseN it never panics: if fewer than n tickets are held, releasing more than
+// is held is treated as releasing only the tickets that are held. It returns the
+// number of tickets actually released. It is safe to call ReleaseAll
+// concurrently on a single Semaphore.
+func (s *Semaphore) ReleaseAll(n int) int {
+	if n <= 0 {
+		return 0
+	}
+
+	s.lock.Lock()
+	for {
+		held := s.loadHeld()
+		if n > held {
+			n = held
+		}
+		if n == 0 || s.unclaim(n) {
+			break
+		}
+	}
+	if n > 0 {
+		s.settle()
+	}
+	s.lock.Unlock()
+
+	if n > 0 {
+		s.recordRelease()
+	}
+	return n
+}
+
+// Do acquires a ticket from the semaphore as if by calling Acquire, runs the
+// given work function, and then releases the ticket. If no ticket could be
+// acquired it returns ErrNoTickets without running work, otherwise it returns
+// whatever work returns. The ticket is released even if work panics, in which
+// case the panic is propagated to the caller once the ticket has been released.
+// It is safe to call Do concurrently on a single Semaphore.
+func (s *Semaphore) Do(work func() error) error {
+	if err := s.Acquire(); err != nil {
+		return err
+	}
+	defer s.Release()
+
+	return work()
+}
+
+// Run is the same as Do. It lets a Semaphore be used as a chain.Runner,
+// alongside the other resiliency patterns.
+func (s *Semaphore) Run(work func() error) error {
+	return s.Do(work)
+}
+
+// DoOrElse acquires a ticket from the semaphore as if by calling Acquire and,
+// like Do, runs work while holding it and then releases it. If the semaphore is
+// saturated, so that acquisition fails with ErrNoTickets or ErrTooManyWaiters,
+// it instead runs fallback without holding a ticket, for serving a cheaper
+// degraded response. It returns whatever work or fallback returns, or the
+// acquisition error for any other failure, such as ErrClosed. The ticket is
+// released even if work panics, in which case the panic is propagated to the
+// caller once the ticket has been released. It is safe to call DoOrElse
+// concurrently on a single Semaphore.
+func (s *Semaphore) DoOrElse(work func() error, fallback func() error) error {
+	if err := s.Acquire(); err != nil {
+		if errors.Is(err, ErrNoTickets) || err == ErrTooManyWaiters {
+			return fallback()
+		}
+		return err
+	}
+	defer s.Release()
+
+	return work()
+}
+
+// DoContext acquires a ticket from the semaphore as if by calling
+// AcquireContext, runs the given work function with the same context, and then
+// releases the ticket. If no ticket could be acquired it returns the error from
+// AcquireContext without running work, otherwise it returns whatever work
+// returns. Passing the context through lets the work itself be cancelled, and
+// the context also carries how long the ticket took to acquire, which work can
+// retrieve with WaitDurationFromContext. If the semaphore was constructed with
+// WithWorkTimeout, the context passed to work also has a deadline that far
+// after the ticket was acquired. The ticket is released even if work panics, in
+// which case the panic is propagated to the caller once the ticket has been
+// released. It is safe to call DoContext concurrently on a single Semaphore.
+func (s *Semaphore) DoContext(ctx context.Context, work func(context.Context) error) error {
+	start := time.Now()
+	if err := s.AcquireContext(ctx); err != nil {
+		return err
+	}
+	defer s.Release()
+
+	if s.workTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.workTimeout)
+		defer cancel()
+	}
+	return work(ContextWithWaitDuration(ctx, time.Since(start)))
+}
+
+// Resize changes the ticket-count of the semaphore without disturbing any tickets
+// that are currently held. Growing the semaphore immediately hands the new tickets
+// to any waiting callers. Shrinking it never revokes held tickets; instead new
+// acquisitions fail or wait until enough tickets have been released to bring the
+// semaphore back under its new ticket-count. A ticket-count of zero is allowed and
+// makes all new acquisitions fail immediately with ErrNoTickets until the
+// semaphore is grown again, while a negative ticket-count returns
+// ErrInvalidTickets. Callers already waiting in AcquireN for
+// more tickets than the new ticket-count keep waiting until they time out. It is
+// safe to call Resize concurrently with all other methods on a single Semaphore.
+func (s *Semaphore) Resize(tickets int) error {
+	if tickets < 0 {
+		return ErrInvalidTickets
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	atomic.StoreInt64(&s.tickets, int64(tickets))
+	s.notifyWaiters()
+	return nil
+}
+
+// CompareAndResize resizes the semaphore as if by Resize, but only if its
+// ticket-count is currently expected, reporting whether it did so. This lets
+// several controllers adjust the same semaphore without clobbering each other:
+// one that reads the ticket-count with Cap, computes a new one and then finds
+// that it no longer matches can read it again and retry. A negative
+// ticket-count returns false and ErrInvalidTickets whether or not expected
+// matches. It is safe to call CompareAndResize concurrently with all other
+// methods on a single Semaphore.
+func (s *Semaphore) CompareAndResize(expected, tickets int) (bool, error) {
+	if tickets < 0 {
+		return false, ErrInvalidTickets
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.loadTickets() != expected {
+		return false, nil
+	}
+	atomic.StoreInt64(&s.tickets, int64(tickets))
+	s.notifyWaiters()
+	return true, nil
+}
+
+// Close closes the semaphore. Every subsequent attempt to acquire tickets fails
+// with ErrClosed (or false, for the non-blocking methods), and any callers that
+// are currently waiting for tickets are woken and also fail with ErrClosed.
+// Tickets that are already held are unaffected and should still be released as
+// normal; use Drain to wait for that to happen. Close returns ErrClosed if the
+// semaphore was already closed. It is safe to call Close concurrently with all
+// other methods on a single Semaphore.
+func (s *Semaphore) Close() error {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return &ClosedError{Name: s.name}
+	}
+	s.closed = true
+	s.failWaiters(ErrClosed)
+	s.lock.Unlock()
+
+	if s.onClose != nil {
+		s.onClose()
+	}
+	return nil
+}
+
+// Drain blocks until no tickets are held, returning nil, or until the given
+// context is done, returning ctx.Err(). If the semaphore was constructed with
+// WithLeakTracking, the error is instead a *DrainError wrapping ctx.Err(), which
+// includes the stack trace of every Ticket still held so that whoever failed to
+// release it can be found. It is typically called after Close as part of a
+// graceful shutdown, to wait for in-flight work to finish. It is safe to call
+// Drain concurrently with all other methods on a single Semaphore.
+func (s *Semaphore) Drain(ctx context.Context) error {
+	_, err := s.DrainN(ctx)
+	return err
+}
+
+// DrainN is Drain, additionally returning how many tickets were still held when
+// it gave up, so that shutdown logic can decide whether to wait longer or stop
+// the remaining work forcibly. It returns zero and a nil error if it drained the
+// semaphore, or the number of tickets still held and the same error as Drain
+// otherwise. It waits to be woken by the last release rather than polling. It
+// is safe to call DrainN concurrently with all other methods on a single
+// Semaphore.
+func (s *Semaphore) DrainN(ctx context.Context) (int, error) {
+	outstanding, err := s.drain(ctx)
+	if s.onDrain != nil {
+		s.onDrain(err)
+	}
+	return outstanding, err
+}
+
+func (s *Semaphore) drain(ctx context.Context) (int, error) {
+	s.lock.Lock()
+	if s.loadHeld() == 0 {
+		s.lock.Unlock()
+		return 0, nil
+	}
+	if s.idle == nil {
+		s.idle = make(chan struct{})
+	}
+	idle := s.idle
+	s.updateSlow()
+	// the last ticket may have been released on the fast path just before
+	// updateSlow, without noticing idle
+	s.settle()
+	s.lock.Unlock()
+
+	select {
+	case <-idle:
+		return 0, nil
+	case <-ctx.Done():
+		held := s.loadHeld()
+		if held == 0 {
+			// the last ticket was released right at the deadline
+			return 0, nil
+		}
+		return held, s.drainError(ctx.Err(), held)
+	}
+}
+
+// Reset forcibly returns the semaphore to the state it was constructed in: every
+// ticket is available, the semaphore is open even if it had been closed or
+// paused, leak tracking forgets any outstanding tickets, and the counters
+// reported by CountersSnapshot and WaitLatency start again from zero. Its
+// configuration, including the ticket-count and timeout, is unchanged. Any
+// goroutines blocked in Drain return.
+//
+// Reset is a convenience for reusing a semaphore between test cases or from a
+// pool; it is not a concurrency primitive. It must only be called when no
+// goroutine is acquiring from, holding tickets of, or releasing to the
+// semaphore, since any such goroutine would see its tickets vanish from under it
+// and a later Release would panic.
+func (s *Semaphore) Reset() {
+	s.lock.Lock()
+	s.put(s.loadHeld())
+	s.closed = false
+	s.paused = false
+	s.updateSlow()
+	if s.tracked != nil {
+		s.tracked = make(map[*Ticket]struct{})
+	}
+	s.lock.Unlock()
+
+	s.CountersSnapshot(true)
+	if s.latency != nil {
+		s.latency.reset()
+	}
 }
 
 // IsEmpty will return true if no tickets are being held at that instant.
 // It is safe to call concurrently with Acquire and Release, though do note
 // that the result may then be unpredictable.
 func (s *Semaphore) IsEmpty() bool {
-	return len(s.sem) == 0
+	return s.loadHeld() == 0
+}
+
+// Available returns the number of tickets that could be acquired at that instant.
+// It is never negative, even if the semaphore has been shrunk below the number of
+// tickets currently held. It is safe to call concurrently with Acquire and Release,
+// though do note that the result may then be unpredictable.
+func (s *Semaphore) Available() int {
+	held, tickets := s.loadHeld(), s.loadTickets()
+	if held >= tickets {
+		return 0
+	}
+	return tickets - held
+}
+
+// InUse returns the number of tickets being held at that instant. It is safe to
+// call concurrently with Acquire and Release, though do note that the result may
+// then be unpredictable.
+func (s *Semaphore) InUse() int {
+	return s.loadHeld()
+}
+
+// Cap returns the total ticket-count of the semaphore, as given to New or most
+// recently to Resize.
+func (s *Semaphore) Cap() int {
+	return s.loadTickets()
+}
+
+// WaitCount returns the number of callers blocked waiting for tickets at that
+// instant. It is safe to call concurrently with all other methods, though do note
+// that the result may then be unpredictable.
+func (s *Semaphore) WaitCount() int {
+	return int(atomic.LoadInt64(&s.waiting))
+}
+
+// LongestWait returns how long the caller that has been waiting longest for
+// tickets has been waiting so far, or zero if nobody is waiting. Unlike
+// WaitLatency, which only records waits once they complete, this exposes a
+// caller that is being starved right now. It is safe to call LongestWait
+// concurrently with all other methods on a single Semaphore.
+func (s *Semaphore) LongestWait() time.Duration {
+	s.lock.Lock()
+	var oldest time.Time
+	for elem := s.waiters.Front(); elem != nil; elem = elem.Next() {
+		// with priorities the queue is not in arrival order
+		if since := elem.Value.(*waiter).since; oldest.IsZero() || since.Before(oldest) {
+			oldest = since
+		}
+	}
+	s.lock.Unlock()
+
+	if oldest.IsZero() {
+		return 0
+	}
+	return time.Since(oldest)
+}
+
+// TotalAcquired returns the number of successful acquisitions the semaphore has
+// made since it was constructed. A single call to AcquireN counts once no matter
+// how many tickets it acquires.
+func (s *Semaphore) TotalAcquired() uint64 {
+	return atomic.LoadUint64(&s.acquired)
+}
+
+// TotalTimeouts returns the number of acquisitions that have timed out since the
+// semaphore was constructed, as counted by Counters.TimedOut.
+func (s *Semaphore) TotalTimeouts() uint64 {
+	return atomic.LoadUint64(&s.timeouts)
+}
+
+// defaultTimeout returns the timeout used by acquire methods that don't take
+// one explicitly, with any jitter applied. A negative configured timeout behaves
+// like zero.
+func (s *Semaphore) defaultTimeout() time.Duration {
+	timeout := s.Timeout()
+	if timeout <= 0 {
+		return 0
+	}
+	if s.jitter > 0 {
+		s.randLock.Lock()
+		// take a random float in the range (-s.jitter, +s.jitter) and multiply it by the timeout
+		timeout += time.Duration((s.rand.Float64()*2 - 1) * s.jitter * float64(timeout))
+		s.randLock.Unlock()
+	}
+	return timeout
+}
+
+// timeoutDefault stands in for the timeout returned by defaultTimeout. That is
+// only worked out once the tickets turn out not to be immediately available,
+// since it may call a WithTimeoutFunc or take the jitter lock, and the fast path
+// must do neither.
+const timeoutDefault = time.Duration(math.MinInt64)
+
+// acquire is the shared implementation of the blocking acquire methods. It
+// waits up to timeout for n tickets, queueing at the given priority, and returns
+// errDone if the (possibly nil) done channel is closed first. A zero timeout
+// never waits, a negative timeout waits forever, and timeoutDefault waits for
+// the semaphore's own timeout.
+func (s *Semaphore) acquire(n, priority int, timeout time.Duration, done <-chan struct{}) error {
+	return s.acquireAt(n, priority, timeout, done, nil)
+}
+
+// acquireAt is acquire, additionally storing the waiter's queue position in pos
+// (if not nil) as described by AcquirePos. It leaves pos alone on failures that
+// don't wait.
+func (s *Semaphore) acquireAt(n, priority int, timeout time.Duration, done <-chan struct{}, pos *int) error {
+	return s.acquireWait(n, priority, timeout, time.Time{}, 0, nil, done, pos)
+}
+
+// acquireWait is acquireAt, additionally calling onSoft (if not nil) once if it
+// is still waiting after soft has elapsed, as described by AcquireSoftHard. If
+// deadline is not zero it is when done will be closed, so that a default
+// timeout ending no earlier needs no timer of its own.
+func (s *Semaphore) acquireWait(n, priority int, timeout time.Duration, deadline time.Time, soft time.Duration, onSoft func(), done <-chan struct{}, pos *int) error {
+	if s.fastAcquire(n) {
+		if pos != nil {
+			*pos = 0
+		}
+		s.recordAcquire(0)
+		return nil
+	}
+
+	if timeout == timeoutDefault {
+		timeout = s.defaultTimeout()
+		if !deadline.IsZero() && time.Until(deadline) <= timeout {
+			// the context will expire first, so there's no need for a timer
+			timeout = -1
+		}
+	}
+
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		s.recordRefusal()
+		return &ClosedError{Name: s.name}
+	}
+	if s.paused {
+		s.lock.Unlock()
+		s.recordRefusal()
+		return ErrPaused
+	}
+	tickets := s.loadTickets()
+	if tickets == 0 {
+		// nothing could ever be acquired, so there's no point waiting
+		s.lock.Unlock()
+		s.recordTimeout(0)
+		return &TimeoutError{Name: s.name}
+	}
+	if n > tickets {
+		s.lock.Unlock()
+		s.recordRefusal()
+		return ErrTooManyTickets
+	}
+	if s.take(n) {
+		s.checkSaturation()
+		s.lock.Unlock()
+		if pos != nil {
+			*pos = 0
+		}
+		s.recordAcquire(0)
+		return nil
+	}
+	if timeout == 0 {
+		s.lock.Unlock()
+		s.recordTimeout(0)
+		return &TimeoutError{Name: s.name}
+	}
+	if s.policy == PolicyReject || (s.shedWhenUnhealthy && s.shouldShed()) {
+		s.lock.Unlock()
+		s.recordShed()
+		return &TimeoutError{Name: s.name}
+	}
+	if s.maxWaiters > 0 && atomic.LoadInt64(&s.waiting) >= int64(s.maxWaiters) {
+		if s.policy != PolicyReplaceOldest || !s.fair {
+			s.lock.Unlock()
+			s.recordReject()
+			return ErrTooManyWaiters
+		}
+		// evicted waiters stay counted in waiting until they wake up, so only
+		// evict if the queue itself is full
+		if s.waiters.Len() >= s.maxWaiters {
+			s.preemptOldest()
+		}
+	}
+	w := &waiter{n: n, priority: priority, ready: make(chan struct{}), since: time.Now()}
+	if s.waiterStacks {
+		w.stack = debug.Stack()
+	}
+	elem := s.enqueue(w)
+	if pos != nil && s.fair {
+		*pos = 1
+		for ahead := s.waiters.Front(); ahead != elem; ahead = ahead.Next() {
+			*pos++
+		}
+	}
+	atomic.AddInt64(&s.waiting, 1)
+	// enqueueing turned the slow path on, so a fast-path release may have
+	// returned tickets just before without handing them on
+	s.notifyWaiters()
+	s.lock.Unlock()
+
+	defer atomic.AddInt64(&s.waiting, -1)
+	if s.onWait != nil {
+		s.onWait()
+	}
+
+	var err error
+	var t timer
+	var expired <-chan time.Time
+	start := w.since
+	if timeout > 0 {
+		t = s.newTimer(timeout)
+		expired = t.C
+	}
+	var st timer
+	var softExpired <-chan time.Time
+	if onSoft != nil && soft > 0 && (timeout < 0 || soft < timeout) {
+		st = s.newTimer(soft)
+		softExpired = st.C
+	}
+
+wait:
+	for {
+		select {
+		case <-w.ready:
+			err = w.err
+			break wait
+		case <-done:
+			err = s.abandon(elem, errDone)
+			break wait
+		case <-expired:
+			t.Recycle()
+			expired = nil
+			err = s.abandon(elem, ErrNoTickets)
+			break wait
+		case <-softExpired:
+			st.Recycle()
+			softExpired = nil
+			onSoft()
+		}
+	}
+
+	if expired != nil {
+		t.Stop()
+	}
+	if softExpired != nil {
+		st.Stop()
+	}
+
+	switch err {
+	case nil:
+		s.recordAcquire(time.Since(start))
+	case ErrNoTickets:
+		s.recordTimeout(time.Since(start))
+		return &TimeoutError{Name: s.name, Timeout: timeout}
+	case ErrClosed:
+		s.recordRefusal()
+		return &ClosedError{Name: s.name}
+	case ErrPaused:
+		s.recordRefusal()
+	case ErrPreempted:
+		s.recordReject()
+	case errDone:
+		s.recordCancel()
+	}
+	return err
+}
+
+// failWaiters wakes every waiting caller, failing them with err. It must be
+// called with the lock held.
+func (s *Semaphore) failWaiters(err error) {
+	for elem := s.waiters.Front(); elem != nil; elem = s.waiters.Front() {
+		w := s.waiters.Remove(elem).(*waiter)
+		w.err = err
+		close(w.ready)
+	}
+	s.checkContention()
+}
+
+// isClosed reports whether Close has been called.
+func (s *Semaphore) isClosed() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.closed
+}
+
+// tryAcquire takes n tickets if they are all immediately available, reporting
+// whether it did so.
+func (s *Semaphore) tryAcquire(n int) bool {
+	if s.fastAcquire(n) {
+		return true
+	}
+
+	s.lock.Lock()
+	refused := s.closed || s.paused
+	ok := s.take(n)
+	if ok {
+		s.checkSaturation()
+	}
+	s.lock.Unlock()
+
+	switch {
+	case ok:
+	case refused:
+		s.recordRefusal()
+	default:
+		s.recordMiss()
+	}
+	return ok
+}
+
+// release returns n tickets to the semaphore, reporting false without releasing
+// anything if fewer than n are held. It only takes the lock if the slow path is
+// in use; checking for that after returning the tickets, rather than before,
+// guarantees that either release sees the slow path turned on or whoever turns
+// it on sees the returned tickets, so that no waiter misses them.
+func (s *Semaphore) release(n int) bool {
+	if invariantChecks && s.invariants {
+		atomic.AddInt64(&s.releasing, 1)
+		defer atomic.AddInt64(&s.releasing, -1)
+	}
+	if !s.unclaim(n) {
+		return false
+	}
+	if atomic.LoadInt32(&s.slow) != 0 {
+		s.lock.Lock()
+		s.settle()
+		s.lock.Unlock()
+	}
+	return true
+}
+
+// put returns n held tickets to the semaphore, handing them on to any waiters
+// that can now be served. It must be called with the lock held.
+func (s *Semaphore) put(n int) {
+	s.unclaim(n)
+	s.settle()
+}
+
+// settle does everything that is due once tickets have been returned: waking
+// Drain if none are held any more and handing them on to any waiters that can
+// now be served. It must be called with the lock held.
+func (s *Semaphore) settle() {
+	if s.idle != nil && s.loadHeld() == 0 {
+		close(s.idle)
+		s.idle = nil
+	}
+	s.notifyWaiters()
+}
+
+// The record methods update the statistics and run any hooks for the
+// corresponding event. They must be called without the lock held, so that hooks
+// are free to call back into the semaphore.
+
+func (s *Semaphore) recordAcquire(waited time.Duration) {
+	atomic.AddUint64(&s.acquired, 1)
+	if s.latency != nil {
+		s.latency.record(waited)
+	}
+	if s.onAcquire != nil {
+		s.onAcquire(waited)
+	}
+}
+
+func (s *Semaphore) recordRelease() {
+	if s.onRelease != nil {
+		s.onRelease()
+	}
+}
+
+func (s *Semaphore) recordTimeout(waited time.Duration) {
+	atomic.AddUint64(&s.timeouts, 1)
+	if s.onTimeout != nil {
+		s.onTimeout(waited)
+	}
+}
+
+func (s *Semaphore) recordCancel() {
+	atomic.AddUint64(&s.cancels, 1)
+}
+
+func (s *Semaphore) recordReject() {
+	atomic.AddUint64(&s.rejects, 1)
+}
+
+// recordShed records an acquisition that a policy refused to let wait. It fails
+// with ErrNoTickets like a timeout, so the timeout hooks are called, but it is
+// counted as rejected.
+func (s *Semaphore) recordShed() {
+	s.recordReject()
+	if s.onTimeout != nil {
+		s.onTimeout(0)
+	}
+}
+
+// recordMiss records a non-blocking acquisition that found no ticket free. It
+// is counted as timed out, as if it had a timeout of zero, but doesn't fail with
+// ErrNoTickets so the timeout hooks are not called.
+func (s *Semaphore) recordMiss() {
+	atomic.AddUint64(&s.timeouts, 1)
+}
+
+func (s *Semaphore) recordRefusal() {
+	atomic.AddUint64(&s.refusals, 1)
+}
+
+// enqueue adds a waiter to the wait queue behind every existing waiter of equal
+// or higher priority, and returns its position in the queue. It must be called
+// with the lock held.
+func (s *Semaphore) enqueue(w *waiter) *list.Element {
+	var inserted *list.Element
+	for elem := s.waiters.Back(); elem != nil && inserted == nil; elem = elem.Prev() {
+		if elem.Value.(*waiter).priority >= w.priority {
+			inserted = s.waiters.InsertAfter(w, elem)
+		}
+	}
+	if inserted == nil {
+		inserted = s.waiters.PushFront(w)
+	}
+	s.checkContention()
+	return inserted
+}
+
+// abandon removes a waiter that has given up from the wait queue and returns err.
+// If the tickets were handed over in the meantime, or a timed-out waiter finds
+// that it can take them after all, then a timed-out waiter keeps them and
+// abandon returns nil, while an interrupted waiter gives them back.
+func (s *Semaphore) abandon(elem *list.Element, err error) error {
+	w := elem.Value.(*waiter)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	select {
+	case <-w.ready:
+		if w.err != nil {
+			return w.err
+		}
+		if err == ErrNoTickets {
+			return nil
+		}
+		s.put(w.n)
+	default:
+		s.waiters.Remove(elem)
+		if err == ErrNoTickets && s.take(w.n) {
+			// the tickets are free right at the deadline, so don't report a
+			// spurious timeout
+			s.checkSaturation()
+			s.checkContention()
+			return nil
+		}
+		// in fair mode this waiter may have been blocking the ones behind it
+		s.notifyWaiters()
+	}
+	return err
+}
+
+// take takes n tickets if they may be taken immediately, without joining the
+// wait queue, reporting whether it did so. In fair mode nobody may jump ahead of
+// an existing waiter. It must be called with the lock held.
+func (s *Semaphore) take(n int) bool {
+	if s.closed || s.paused {
+		return false
+	}
+	if s.fair && s.waiters.Len() > 0 {
+		return false
+	}
+	return s.claim(n)
+}
+
+// fastAcquire tries to take n tickets without the lock, which is only allowed
+// while the slow path is off: while nobody is waiting, the semaphore is open and
+// not paused, and neither Drain nor Notify need to observe the change. It
+// reports whether it took them; if not the caller must fall back to the slow
+// path.
+func (s *Semaphore) fastAcquire(n int) bool {
+	if atomic.LoadInt32(&s.slow) != 0 || !s.claim(n) {
+		return false
+	}
+	if atomic.LoadInt32(&s.slow) == 0 {
+		return true
+	}
+
+	// the slow path was turned on while the tickets were being claimed, so
+	// whatever turned it on may have missed them
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed || s.paused {
+		s.put(n)
+		return false
+	}
+	s.checkSaturation()
+	s.checkContention()
+	return true
+}
+
+// claim adds n to the number of tickets held if that doesn't exceed the
+// ticket-count, reporting whether it did so. It is safe to call without the
+// lock held.
+func (s *Semaphore) claim(n int) bool {
+	for {
+		held := atomic.LoadInt64(&s.held)
+		tickets := atomic.LoadInt64(&s.tickets)
+		if held+int64(n) > tickets {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&s.held, held, held+int64(n)) {
+			if invariantChecks && s.invariants {
+				s.checkClaim(n, held+int64(n), tickets)
+			}
+			return true
+		}
+	}
+}
+
+// unclaim subtracts n from the number of tickets held unless fewer than n are
+// held, reporting whether it did so. It is safe to call without the lock held.
+func (s *Semaphore) unclaim(n int) bool {
+	for {
+		held := atomic.LoadInt64(&s.held)
+		if held < int64(n) {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&s.held, held, held-int64(n)) {
+			if invariantChecks && s.invariants {
+				s.checkUnclaim(n, held-int64(n))
+			}
+			return true
+		}
+	}
+}
+
+func (s *Semaphore) loadHeld() int {
+	return int(atomic.LoadInt64(&s.held))
+}
+
+func (s *Semaphore) loadTickets() int {
+	return int(atomic.LoadInt64(&s.tickets))
+}
+
+// updateSlow turns the slow path on or off to match the current state. Anything
+// that turns it on must afterwards deal with tickets returned on the fast path
+// just before, typically by calling notifyWaiters. It must be called with the
+// lock held.
+func (s *Semaphore) updateSlow() {
+	var slow int32
+	if s.closed || s.paused || s.waiters.Len() > 0 || s.idle != nil || s.events != nil || s.shedding {
+		slow = 1
+	}
+	atomic.StoreInt32(&s.slow, slow)
+}
+
+// notifyWaiters hands tickets to waiters in the order they arrived. Normally
+// every waiter that fits within the ticket-count is served, but in fair mode it
+// stops at the first waiter that does not fit so that nobody overtakes it. It
+// must be called with the lock held.
+func (s *Semaphore) notifyWaiters() {
+	for elem := s.waiters.Front(); elem != nil && s.loadHeld() < s.loadTickets(); {
+		next := elem.Next()
+		w := elem.Value.(*waiter)
+		if s.claim(w.n) {
+			s.waiters.Remove(elem)
+			close(w.ready)
+		} else if s.fair {
+			break
+		}
+		elem = next
+	}
+	if invariantChecks && s.invariants {
+		s.checkWaiters()
+	}
+	s.checkSaturation()
+	s.checkContention()
 }
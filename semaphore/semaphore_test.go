@@ -1,6 +1,10 @@
 package semaphore
 
 import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -32,7 +36,7 @@ func TestSemaphoreBlockTimeout(t *testing.T) {
 	}
 
 	start := time.Now()
-	if err := sem.Acquire(); err != ErrNoTickets {
+	if err := sem.Acquire(); !errors.Is(err, ErrNoTickets) {
 		t.Error(err)
 	}
 	if start.Add(200 * time.Millisecond).After(time.Now()) {
@@ -45,6 +49,1055 @@ func TestSemaphoreBlockTimeout(t *testing.T) {
 	}
 }
 
+func TestSemaphoreAcquireContext(t *testing.T) {
+	sem := New(1, 200*time.Millisecond)
+
+	if err := sem.AcquireContext(context.Background()); err != nil {
+		t.Error(err)
+	}
+
+	start := time.Now()
+	if err := sem.AcquireContext(context.Background()); !errors.Is(err, ErrNoTickets) {
+		t.Error(err)
+	}
+	if start.Add(200 * time.Millisecond).After(time.Now()) {
+		t.Error("semaphore did not wait long enough")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+
+	start = time.Now()
+	if err := sem.AcquireContext(ctx); err != context.Canceled {
+		t.Error(err)
+	}
+	if time.Since(start) >= 200*time.Millisecond {
+		t.Error("semaphore did not respect the cancelled context")
+	}
+
+	sem.Release()
+	if err := sem.AcquireContext(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSemaphoreAcquireTimeout(t *testing.T) {
+	sem := New(1, 1*time.Second)
+
+	if err := sem.AcquireTimeout(0); err != nil {
+		t.Error(err)
+	}
+
+	start := time.Now()
+	if err := sem.AcquireTimeout(0); !errors.Is(err, ErrNoTickets) {
+		t.Error(err)
+	}
+	if err := sem.AcquireTimeout(20 * time.Millisecond); !errors.Is(err, ErrNoTickets) {
+		t.Error(err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond || elapsed >= 1*time.Second {
+		t.Error("semaphore waited the wrong amount of time", elapsed)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		sem.Release()
+	}()
+	if err := sem.AcquireTimeout(-1); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSemaphoreAcquireSoftHard(t *testing.T) {
+	sem := New(1, 1*time.Second)
+	var soft int32
+	onSoft := func() { atomic.AddInt32(&soft, 1) }
+
+	// acquired immediately, so the soft threshold never elapses
+	if err := sem.AcquireSoftHard(time.Millisecond, 10*time.Millisecond, onSoft); err != nil {
+		t.Error(err)
+	}
+
+	// the soft threshold elapses, then the hard one
+	start := time.Now()
+	if err := sem.AcquireSoftHard(10*time.Millisecond, 30*time.Millisecond, onSoft); !errors.Is(err, ErrNoTickets) {
+		t.Error(err)
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond || elapsed >= 1*time.Second {
+		t.Error("semaphore waited the wrong amount of time", elapsed)
+	}
+	if n := atomic.LoadInt32(&soft); n != 1 {
+		t.Error("expected onSoft to be called once, got", n)
+	}
+
+	// the soft threshold elapses, then a ticket is released before the hard one
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		sem.Release()
+	}()
+	if err := sem.AcquireSoftHard(10*time.Millisecond, -1, onSoft); err != nil {
+		t.Error(err)
+	}
+	if n := atomic.LoadInt32(&soft); n != 2 {
+		t.Error("expected onSoft to be called twice, got", n)
+	}
+
+	// a soft threshold beyond the hard one never fires
+	if err := sem.AcquireSoftHard(20*time.Millisecond, 10*time.Millisecond, onSoft); !errors.Is(err, ErrNoTickets) {
+		t.Error(err)
+	}
+	if n := atomic.LoadInt32(&soft); n != 2 {
+		t.Error("expected onSoft not to be called again, got", n)
+	}
+}
+
+func TestSemaphoreAcquireWithStop(t *testing.T) {
+	sem := New(1, 50*time.Millisecond)
+
+	if err := sem.AcquireWithStop(nil); err != nil {
+		t.Error(err)
+	}
+
+	// the timeout expires first
+	stop := make(chan struct{})
+	if err := sem.AcquireWithStop(stop); !errors.Is(err, ErrNoTickets) {
+		t.Error(err)
+	}
+
+	// the stop channel is closed first
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(stop)
+	}()
+	start := time.Now()
+	if err := sem.AcquireWithStop(stop); err != ErrInterrupted {
+		t.Error(err)
+	}
+	if elapsed := time.Since(start); elapsed >= 50*time.Millisecond {
+		t.Error("semaphore should have been interrupted before the timeout", elapsed)
+	}
+	if sem.WaitCount() != 0 {
+		t.Error("the interrupted waiter should have left the queue")
+	}
+
+	// a ticket is released first
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		sem.Release()
+	}()
+	if err := sem.AcquireWithStop(make(chan struct{})); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSemaphoreAcquireContextDeadlines(t *testing.T) {
+	sem := New(1, 50*time.Millisecond)
+	sem.Acquire()
+	defer sem.Release()
+
+	// the context's deadline comes first
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	start := time.Now()
+	err := sem.AcquireContext(ctx)
+	cancel()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Error(err)
+	}
+	if elapsed := time.Since(start); elapsed < 10*time.Millisecond || elapsed >= 50*time.Millisecond {
+		t.Error("semaphore waited the wrong amount of time", elapsed)
+	}
+
+	// the timeout comes first
+	ctx, cancel = context.WithTimeout(context.Background(), 1*time.Second)
+	start = time.Now()
+	err = sem.AcquireContext(ctx)
+	cancel()
+	if !errors.Is(err, ErrNoTickets) {
+		t.Error(err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond || elapsed >= 1*time.Second {
+		t.Error("semaphore waited the wrong amount of time", elapsed)
+	}
+
+	// they coincide, which is always reported as the context's deadline
+	for i := 0; i < 10; i++ {
+		ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+		err = sem.AcquireContext(ctx)
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Error(err)
+		}
+	}
+
+	// an already-expired context without a free ticket fails straight away
+	ctx, cancel = context.WithTimeout(context.Background(), -1)
+	err = sem.AcquireContext(ctx)
+	cancel()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Error(err)
+	}
+}
+
+func TestSemaphoreAcquireChan(t *testing.T) {
+	sem := New(1, 20*time.Millisecond)
+
+	if err := <-sem.AcquireChan(); err != nil {
+		t.Error(err)
+	}
+
+	result := sem.AcquireChan()
+	other := make(chan struct{})
+	select {
+	case err := <-result:
+		t.Error("acquisition should still be waiting", err)
+	case <-other:
+		t.Error("nothing should have been sent")
+	case <-time.After(5 * time.Millisecond):
+	}
+	if err := <-result; !errors.Is(err, ErrNoTickets) {
+		t.Error(err)
+	}
+
+	result = sem.AcquireChan()
+	sem.Release()
+	if err := <-result; err != nil {
+		t.Error(err)
+	}
+	sem.Release()
+}
+
+func TestSemaphoreSetTimeout(t *testing.T) {
+	sem := New(1, 1*time.Second)
+	if sem.Timeout() != 1*time.Second {
+		t.Error("wrong timeout", sem.Timeout())
+	}
+	sem.Acquire()
+
+	// an acquisition already waiting keeps its original deadline
+	result := sem.AcquireChan()
+	for sem.WaitCount() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	sem.SetTimeout(10 * time.Millisecond)
+	if sem.Timeout() != 10*time.Millisecond {
+		t.Error("wrong timeout", sem.Timeout())
+	}
+
+	start := time.Now()
+	if err := sem.Acquire(); !errors.Is(err, ErrNoTickets) {
+		t.Error(err)
+	}
+	if time.Since(start) >= 1*time.Second {
+		t.Error("new timeout was not used")
+	}
+
+	select {
+	case err := <-result:
+		t.Error("waiting acquisition should have kept its deadline", err)
+	default:
+	}
+
+	sem.Release()
+	if err := <-result; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSemaphoreTryAcquire(t *testing.T) {
+	sem := New(2, 200*time.Millisecond)
+
+	if !sem.TryAcquire() {
+		t.Error("semaphore should have had a ticket")
+	}
+	if !sem.TryAcquire() {
+		t.Error("semaphore should have had a ticket")
+	}
+
+	start := time.Now()
+	if sem.TryAcquire() {
+		t.Error("semaphore should not have had a ticket")
+	}
+	if time.Since(start) >= 200*time.Millisecond {
+		t.Error("semaphore should not have waited")
+	}
+
+	sem.Release()
+	if !sem.TryAcquire() {
+		t.Error("semaphore should have had a ticket")
+	}
+}
+
+func TestSemaphoreTryAcquireN(t *testing.T) {
+	sem := New(5, 1*time.Second)
+
+	if !sem.TryAcquireN(3) {
+		t.Error("semaphore should have had the tickets")
+	}
+	if sem.TryAcquireN(3) {
+		t.Error("semaphore should not have had the tickets")
+	}
+	if sem.InUse() != 3 {
+		t.Error("failed call should not hold any tickets", sem.InUse())
+	}
+	if !sem.TryAcquireN(2) {
+		t.Error("semaphore should have had the tickets")
+	}
+	sem.ReleaseN(5)
+
+	// many goroutines contending for varying weights never overfill it
+	var held, maxHeld int64
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if !sem.TryAcquireN(n) {
+					continue
+				}
+				now := atomic.AddInt64(&held, int64(n))
+				for {
+					max := atomic.LoadInt64(&maxHeld)
+					if now <= max || atomic.CompareAndSwapInt64(&maxHeld, max, now) {
+						break
+					}
+				}
+				atomic.AddInt64(&held, -int64(n))
+				sem.ReleaseN(n)
+			}
+		}(i%5 + 1)
+	}
+	wg.Wait()
+
+	if maxHeld > 5 {
+		t.Error("semaphore handed out too many tickets", maxHeld)
+	}
+	if !sem.IsEmpty() {
+		t.Error("semaphore should be empty")
+	}
+}
+
+func TestSemaphoreTryRelease(t *testing.T) {
+	sem := New(1, 200*time.Millisecond)
+
+	if err := sem.TryRelease(); err != ErrNotAcquired {
+		t.Error(err)
+	}
+
+	sem.Acquire()
+	if err := sem.TryRelease(); err != nil {
+		t.Error(err)
+	}
+	if err := sem.TryRelease(); err != ErrNotAcquired {
+		t.Error(err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("over-release should panic")
+		}
+	}()
+	sem.Release()
+}
+
+func TestSemaphoreAcquireN(t *testing.T) {
+	sem := New(3, 200*time.Millisecond)
+
+	if err := sem.AcquireN(2); err != nil {
+		t.Error(err)
+	}
+
+	start := time.Now()
+	if err := sem.AcquireN(2); !errors.Is(err, ErrNoTickets) {
+		t.Error(err)
+	}
+	if start.Add(200 * time.Millisecond).After(time.Now()) {
+		t.Error("semaphore did not wait long enough")
+	}
+
+	// the failed call must not have kept its partial ticket
+	if err := sem.Acquire(); err != nil {
+		t.Error(err)
+	}
+	sem.Release()
+
+	if err := sem.AcquireN(4); err != ErrTooManyTickets {
+		t.Error(err)
+	}
+
+	sem.ReleaseN(2)
+	if !sem.IsEmpty() {
+		t.Error("semaphore should be empty")
+	}
+
+	if err := sem.AcquireN(3); err != nil {
+		t.Error(err)
+	}
+	sem.ReleaseN(3)
+}
+
+func TestSemaphoreReleaseNNegative(t *testing.T) {
+	sem := New(1, 10*time.Millisecond)
+
+	// releasing a negative number of tickets must not conjure held ones
+	sem.ReleaseN(-1)
+	sem.ReleaseN(0)
+	if !sem.IsEmpty() {
+		t.Error("semaphore should still be empty, but", sem.InUse(), "are held")
+	}
+	if err := sem.Acquire(); err != nil {
+		t.Error(err)
+	}
+	sem.ReleaseN(-1)
+	if sem.InUse() != 1 {
+		t.Error(sem.InUse())
+	}
+	sem.Release()
+}
+
+func TestSemaphoreAcquirePos(t *testing.T) {
+	sem := NewWithOptions(1, WithTimeout(time.Second), WithFairness())
+	ctx := context.Background()
+
+	if pos, err := sem.AcquirePos(ctx); pos != 0 || err != nil {
+		t.Error(pos, err)
+	}
+
+	type result struct {
+		pos int
+		err error
+	}
+	results := make(chan result)
+	for i := 1; i <= 2; i++ {
+		go func() {
+			pos, err := sem.AcquirePos(ctx)
+			results <- result{pos, err}
+		}()
+		for sem.WaitCount() != i {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	for i := 1; i <= 2; i++ {
+		sem.Release()
+		if r := <-results; r.pos != i || r.err != nil {
+			t.Errorf("expected position %d, got %d (%v)", i, r.pos, r.err)
+		}
+	}
+
+	sem.Close()
+	if pos, err := sem.AcquirePos(ctx); pos != -1 || !errors.Is(err, ErrClosed) {
+		t.Error(pos, err)
+	}
+	sem.Release()
+
+	// without fairness the position is unknown
+	sem = New(1, time.Second)
+	sem.Acquire()
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		sem.Release()
+	}()
+	if pos, err := sem.AcquirePos(ctx); pos != -1 || err != nil {
+		t.Error(pos, err)
+	}
+}
+
+func TestSemaphoreAcquireWithPriority(t *testing.T) {
+	sem := New(1, 1*time.Second)
+	sem.Acquire()
+
+	priorities := []int{0, 1, 5, 1, 5, 0}
+	order := make(chan int, len(priorities))
+	for i, p := range priorities {
+		go func(i, p int) {
+			if err := sem.AcquireWithPriority(p); err != nil {
+				t.Error(err)
+			}
+			order <- i
+			sem.Release()
+		}(i, p)
+		for sem.WaitCount() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	sem.Release()
+	// highest priority first, ties broken by arrival order
+	for _, expected := range []int{2, 4, 1, 3, 0, 5} {
+		if got := <-order; got != expected {
+			t.Errorf("expected waiter %d, got %d", expected, got)
+		}
+	}
+}
+
+func TestSemaphoreReleaseAll(t *testing.T) {
+	sem := New(3, 1*time.Second)
+	sem.AcquireN(3)
+
+	if n := sem.ReleaseAll(2); n != 2 || sem.InUse() != 1 {
+		t.Error(n, sem.InUse())
+	}
+	if n := sem.ReleaseAll(5); n != 1 || !sem.IsEmpty() {
+		t.Error("over-release should only release what is held, got", n)
+	}
+	if n := sem.ReleaseAll(1); n != 0 {
+		t.Error("nothing should be released from an empty semaphore, got", n)
+	}
+	if n := sem.ReleaseAll(-1); n != 0 {
+		t.Error(n)
+	}
+}
+
+func TestSemaphoreDo(t *testing.T) {
+	sem := New(1, 50*time.Millisecond)
+	errWork := errors.New("errWork")
+
+	ran := false
+	err := sem.Do(func() error {
+		ran = true
+		if sem.Available() != 0 {
+			t.Error("ticket should be held while work runs")
+		}
+		return errWork
+	})
+	if err != errWork {
+		t.Error(err)
+	}
+	if !ran {
+		t.Error("work did not run")
+	}
+	if !sem.IsEmpty() {
+		t.Error("semaphore should be empty")
+	}
+
+	sem.Acquire()
+	err = sem.Do(func() error {
+		t.Error("work should not run without a ticket")
+		return nil
+	})
+	if !errors.Is(err, ErrNoTickets) {
+		t.Error(err)
+	}
+	sem.Release()
+
+	func() {
+		defer func() {
+			if r := recover(); r != "oops" {
+				t.Error("expected panic to propagate, got", r)
+			}
+		}()
+		sem.Do(func() error {
+			panic("oops")
+		})
+	}()
+	if !sem.IsEmpty() {
+		t.Error("semaphore should be empty after panic")
+	}
+}
+
+func TestSemaphoreDoOrElse(t *testing.T) {
+	sem := NewWithOptions(1, WithTimeout(10*time.Millisecond), WithMaxWaiters(1))
+	errWork := errors.New("errWork")
+	errFallback := errors.New("errFallback")
+
+	work := func() error {
+		if sem.Available() != 0 {
+			t.Error("ticket should be held while work runs")
+		}
+		return errWork
+	}
+	fallback := func() error {
+		return errFallback
+	}
+
+	if err := sem.DoOrElse(work, fallback); err != errWork {
+		t.Error(err)
+	}
+	if !sem.IsEmpty() {
+		t.Error("semaphore should be empty")
+	}
+
+	sem.Acquire()
+	if err := sem.DoOrElse(work, fallback); err != errFallback {
+		t.Error("fallback should run on timeout, got", err)
+	}
+
+	waiting := make(chan error)
+	go func() {
+		waiting <- sem.AcquireTimeout(time.Second)
+	}()
+	for sem.WaitCount() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := sem.DoOrElse(work, fallback); err != errFallback {
+		t.Error("fallback should run when too many callers are waiting, got", err)
+	}
+	sem.Release()
+	<-waiting
+	sem.Release()
+
+	func() {
+		defer func() {
+			if r := recover(); r != "oops" {
+				t.Error("expected panic to propagate, got", r)
+			}
+		}()
+		sem.DoOrElse(func() error {
+			panic("oops")
+		}, fallback)
+	}()
+	if !sem.IsEmpty() {
+		t.Error("semaphore should be empty after panic")
+	}
+
+	sem.Close()
+	if err := sem.DoOrElse(work, fallback); !errors.Is(err, ErrClosed) {
+		t.Error(err)
+	}
+}
+
+func TestSemaphoreDoContext(t *testing.T) {
+	sem := New(1, 1*time.Second)
+	errWork := errors.New("errWork")
+	type key struct{}
+	ctx := context.WithValue(context.Background(), key{}, "value")
+
+	err := sem.DoContext(ctx, func(workCtx context.Context) error {
+		if workCtx.Value(key{}) != "value" {
+			t.Error("work should receive the caller's context")
+		}
+		if sem.Available() != 0 {
+			t.Error("ticket should be held while work runs")
+		}
+		return errWork
+	})
+	if err != errWork {
+		t.Error(err)
+	}
+	if !sem.IsEmpty() {
+		t.Error("semaphore should be empty")
+	}
+
+	sem.Acquire()
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	err = sem.DoContext(cancelled, func(context.Context) error {
+		t.Error("work should not run without a ticket")
+		return nil
+	})
+	if err != context.Canceled {
+		t.Error(err)
+	}
+	sem.Release()
+
+	func() {
+		defer func() {
+			if r := recover(); r != "oops" {
+				t.Error("expected panic to propagate, got", r)
+			}
+		}()
+		sem.DoContext(ctx, func(context.Context) error {
+			panic("oops")
+		})
+	}()
+	if !sem.IsEmpty() {
+		t.Error("semaphore should be empty after panic")
+	}
+}
+
+func TestSemaphoreResize(t *testing.T) {
+	sem := New(1, 200*time.Millisecond)
+
+	if err := sem.Acquire(); err != nil {
+		t.Error(err)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		if err := sem.Resize(2); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	start := time.Now()
+	if err := sem.Acquire(); err != nil {
+		t.Error(err)
+	}
+	if time.Since(start) >= 200*time.Millisecond {
+		t.Error("growing the semaphore did not wake the waiter")
+	}
+
+	// shrinking keeps both held tickets, but blocks new acquisitions until
+	// enough have been released
+	if err := sem.Resize(1); err != nil {
+		t.Error(err)
+	}
+	sem.Release()
+	if sem.TryAcquire() {
+		t.Error("semaphore should not have had a ticket")
+	}
+	sem.Release()
+	if !sem.TryAcquire() {
+		t.Error("semaphore should have had a ticket")
+	}
+	sem.Release()
+
+	if err := sem.Resize(0); err != nil {
+		t.Error(err)
+	}
+	if sem.TryAcquire() {
+		t.Error("semaphore should not have had a ticket")
+	}
+
+	if err := sem.Resize(-1); err != ErrInvalidTickets {
+		t.Error(err)
+	}
+}
+
+func TestSemaphoreCompareAndResize(t *testing.T) {
+	sem := New(2, 10*time.Millisecond)
+
+	if ok, err := sem.CompareAndResize(3, 5); ok || err != nil || sem.Cap() != 2 {
+		t.Error("a mismatched resize should not apply", ok, err, sem.Cap())
+	}
+	if ok, err := sem.CompareAndResize(2, 5); !ok || err != nil || sem.Cap() != 5 {
+		t.Error("a matching resize should apply", ok, err, sem.Cap())
+	}
+	if ok, err := sem.CompareAndResize(5, -1); ok || err != ErrInvalidTickets {
+		t.Error(ok, err)
+	}
+
+	// racing controllers each add to the ticket-count without losing updates
+	const controllers, steps = 8, 100
+	var wg sync.WaitGroup
+	for i := 0; i < controllers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < steps; j++ {
+				for {
+					current := sem.Cap()
+					if ok, _ := sem.CompareAndResize(current, current+1); ok {
+						break
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if sem.Cap() != 5+controllers*steps {
+		t.Error("lost resizes, got a ticket-count of", sem.Cap())
+	}
+}
+
+func TestSemaphoreZeroTickets(t *testing.T) {
+	sem := New(0, time.Hour)
+
+	start := time.Now()
+	for _, acquire := range []func() error{
+		sem.Acquire,
+		// not ErrTooManyTickets, even though 2 exceeds the ticket-count
+		func() error { return sem.AcquireN(2) },
+		func() error { return sem.AcquireContext(context.Background()) },
+		func() error { return sem.AcquireTimeout(-1) },
+	} {
+		if err := acquire(); !errors.Is(err, ErrNoTickets) {
+			t.Error(err)
+		}
+	}
+	if time.Since(start) > 100*time.Millisecond {
+		t.Error("a zero-capacity semaphore should not wait")
+	}
+	if sem.TryAcquire() {
+		t.Error("a zero-capacity semaphore should not hand out tickets")
+	}
+	if sem.TotalTimeouts() != 5 {
+		t.Error(sem.TotalTimeouts())
+	}
+
+	sem.Resize(1)
+	if err := sem.Acquire(); err != nil {
+		t.Error(err)
+	}
+	sem.Release()
+}
+
+func TestSemaphoreClose(t *testing.T) {
+	sem := New(1, 1*time.Second)
+	sem.Acquire()
+
+	waiting := make(chan error)
+	go func() {
+		waiting <- sem.Acquire()
+	}()
+	for sem.WaitCount() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := sem.Close(); err != nil {
+		t.Error(err)
+	}
+	if err := <-waiting; !errors.Is(err, ErrClosed) {
+		t.Error("waiter should have been woken with ErrClosed, got", err)
+	}
+	if err := sem.Close(); !errors.Is(err, ErrClosed) {
+		t.Error(err)
+	}
+
+	if err := sem.Acquire(); !errors.Is(err, ErrClosed) {
+		t.Error(err)
+	}
+	if sem.TryAcquire() {
+		t.Error("closed semaphore should not hand out tickets")
+	}
+
+	// held tickets are unaffected
+	if sem.InUse() != 1 {
+		t.Error("held ticket should remain held")
+	}
+	sem.Release()
+}
+
+func TestSemaphoreClosedEntryPoints(t *testing.T) {
+	sem := New(3, 1*time.Second)
+	sem.Close()
+
+	for name, acquire := range map[string]func() error{
+		"Acquire":        sem.Acquire,
+		"AcquireN":       func() error { return sem.AcquireN(2) },
+		"AcquireN(0)":    func() error { return sem.AcquireN(0) },
+		"AcquireContext": func() error { return sem.AcquireContext(context.Background()) },
+		"AcquireChan":    func() error { return <-sem.AcquireChan() },
+		"AcquireTimeout": func() error { return sem.AcquireTimeout(-1) },
+	} {
+		if err := acquire(); !errors.Is(err, ErrClosed) {
+			t.Errorf("%s: expected ErrClosed, got %v", name, err)
+		}
+	}
+
+	if sem.TryAcquire() {
+		t.Error("TryAcquire should fail on a closed semaphore")
+	}
+	if sem.TryAcquireN(2) || sem.TryAcquireN(0) {
+		t.Error("TryAcquireN should fail on a closed semaphore")
+	}
+	if sem.InUse() != 0 || sem.TotalAcquired() != 0 {
+		t.Error("closed semaphore should not have handed out tickets")
+	}
+}
+
+func TestSemaphoreTryAcquireContext(t *testing.T) {
+	sem := New(1, 1*time.Second)
+	ctx := context.Background()
+
+	if ok, err := sem.TryAcquireContext(ctx); !ok || err != nil {
+		t.Error(ok, err)
+	}
+	if ok, err := sem.TryAcquireContext(ctx); ok || err != nil {
+		t.Error(ok, err)
+	}
+	sem.Release()
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if ok, err := sem.TryAcquireContext(cancelled); ok || err != context.Canceled {
+		t.Error(ok, err)
+	}
+	if sem.InUse() != 0 {
+		t.Error("a done context should not acquire a ticket")
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		sem.TryAcquireContext(ctx)
+		sem.Release()
+	})
+	if allocs != 0 {
+		t.Error("TryAcquireContext should not allocate, got", allocs)
+	}
+
+	sem.Close()
+	if ok, err := sem.TryAcquireContext(ctx); ok || !errors.Is(err, ErrClosed) {
+		t.Error(ok, err)
+	}
+}
+
+func TestSemaphoreLongestWait(t *testing.T) {
+	sem := New(1, 1*time.Second)
+	if sem.LongestWait() != 0 {
+		t.Error("nobody is waiting")
+	}
+	sem.Acquire()
+
+	done := make(chan error)
+	go func() {
+		done <- sem.Acquire()
+	}()
+	for sem.WaitCount() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	// a newer, higher-priority waiter goes to the front of the queue, but the
+	// older one is still the longest waiting
+	go func() {
+		done <- sem.AcquireWithPriority(1)
+	}()
+	for sem.WaitCount() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	if wait := sem.LongestWait(); wait < 20*time.Millisecond || wait > 500*time.Millisecond {
+		t.Error(wait)
+	}
+
+	sem.Release()
+	<-done
+	sem.Release()
+	<-done
+	if sem.LongestWait() != 0 {
+		t.Error("nobody is waiting")
+	}
+	sem.Release()
+}
+
+func TestSemaphoreReset(t *testing.T) {
+	sem := NewWithOptions(3, WithLatencyHistogram(), WithLeakTracking())
+
+	sem.AcquireN(2)
+	sem.AcquireTicket()
+	sem.TryAcquire()
+	sem.Close()
+
+	drained := make(chan error)
+	go func() {
+		drained <- sem.Drain(context.Background())
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	sem.Reset()
+
+	if err := <-drained; err != nil {
+		t.Error(err)
+	}
+	if sem.Available() != 3 || sem.InUse() != 0 {
+		t.Error("all tickets should be available after Reset")
+	}
+	if sem.TotalAcquired() != 0 || sem.TotalTimeouts() != 0 || sem.WaitLatency().Count != 0 {
+		t.Error("counters should be zero after Reset")
+	}
+	sem.AssertNoLeaks(t)
+
+	if err := sem.AcquireN(3); err != nil {
+		t.Error("semaphore should be usable again after Reset, got", err)
+	}
+	if sem.TotalAcquired() != 1 {
+		t.Error(sem.TotalAcquired())
+	}
+	sem.ReleaseN(3)
+}
+
+func TestSemaphoreDrain(t *testing.T) {
+	sem := New(2, 1*time.Second)
+
+	if err := sem.Drain(context.Background()); err != nil {
+		t.Error(err)
+	}
+
+	sem.AcquireN(2)
+	sem.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := sem.Drain(ctx); err != context.DeadlineExceeded {
+		t.Error(err)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		sem.Release()
+		time.Sleep(10 * time.Millisecond)
+		sem.Release()
+	}()
+	if err := sem.Drain(context.Background()); err != nil {
+		t.Error(err)
+	}
+	if !sem.IsEmpty() {
+		t.Error("semaphore should be empty after draining")
+	}
+}
+
+func TestSemaphoreDrainN(t *testing.T) {
+	sem := New(3, 1*time.Second)
+
+	if n, err := sem.DrainN(context.Background()); n != 0 || err != nil {
+		t.Error(n, err)
+	}
+
+	sem.AcquireN(3)
+	sem.Release()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if n, err := sem.DrainN(ctx); n != 2 || err != context.DeadlineExceeded {
+		t.Error(n, err)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		sem.ReleaseN(2)
+	}()
+	if n, err := sem.DrainN(context.Background()); n != 0 || err != nil {
+		t.Error(n, err)
+	}
+}
+
+func TestSemaphoreErrorDetails(t *testing.T) {
+	sem := NewWithOptions(1, WithName("db"), WithTimeout(10*time.Millisecond))
+	sem.Acquire()
+
+	err := sem.Acquire()
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatal("expected a TimeoutError, got", err)
+	}
+	if timeoutErr.Name != "db" || timeoutErr.Timeout != 10*time.Millisecond {
+		t.Error("wrong details", timeoutErr)
+	}
+	if err.Error() != `semaphore "db": could not acquire semaphore ticket within 10ms` {
+		t.Error("wrong message", err)
+	}
+	if !errors.Is(err, ErrUnavailable) || errors.Is(err, ErrBudgetExhausted) {
+		t.Error("a timeout should be unavailable but not out of budget", err)
+	}
+
+	err = sem.AcquireTimeout(0)
+	if !errors.Is(err, ErrNoTickets) || err.Error() != `semaphore "db": could not acquire semaphore ticket within 0s` {
+		t.Error("wrong error", err)
+	}
+
+	sem.Close()
+	err = sem.Acquire()
+	var closedErr *ClosedError
+	if !errors.As(err, &closedErr) || closedErr.Name != "db" {
+		t.Fatal("expected a ClosedError, got", err)
+	}
+	if err.Error() != `semaphore "db": semaphore is closed` {
+		t.Error("wrong message", err)
+	}
+
+	if err := New(1, 0).Close(); err != nil {
+		t.Error(err)
+	}
+	unnamed := New(1, 0)
+	unnamed.Close()
+	if err := unnamed.Close(); !errors.Is(err, ErrClosed) || err.Error() != "semaphore is closed" {
+		t.Error("wrong error", err)
+	}
+}
+
 func TestSemaphoreEmpty(t *testing.T) {
 	sem := New(2, 200*time.Millisecond)
 
@@ -65,6 +1118,251 @@ func TestSemaphoreEmpty(t *testing.T) {
 	}
 }
 
+func TestSemaphoreCounts(t *testing.T) {
+	sem := New(3, 200*time.Millisecond)
+
+	if sem.Cap() != 3 || sem.Available() != 3 || sem.InUse() != 0 {
+		t.Error("wrong counts for new semaphore")
+	}
+
+	if err := sem.AcquireN(2); err != nil {
+		t.Error(err)
+	}
+	if sem.Cap() != 3 || sem.Available() != 1 || sem.InUse() != 2 {
+		t.Error("wrong counts after acquire")
+	}
+
+	if err := sem.Resize(1); err != nil {
+		t.Error(err)
+	}
+	if sem.Cap() != 1 || sem.Available() != 0 || sem.InUse() != 2 {
+		t.Error("wrong counts after shrinking")
+	}
+
+	sem.ReleaseN(2)
+	if sem.Cap() != 1 || sem.Available() != 1 || sem.InUse() != 0 {
+		t.Error("wrong counts after release")
+	}
+}
+
+func TestSemaphoreWaitCount(t *testing.T) {
+	sem := New(1, 200*time.Millisecond)
+
+	sem.Acquire()
+	if sem.WaitCount() != 0 {
+		t.Error("nobody should be waiting")
+	}
+
+	done := make(chan error)
+	for i := 0; i < 3; i++ {
+		go func() {
+			done <- sem.AcquireN(1)
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	if sem.WaitCount() != 3 {
+		t.Error("expected 3 waiters, got", sem.WaitCount())
+	}
+
+	sem.Release()
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+	if sem.WaitCount() != 2 {
+		t.Error("expected 2 waiters, got", sem.WaitCount())
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := <-done; !errors.Is(err, ErrNoTickets) {
+			t.Error(err)
+		}
+	}
+	if sem.WaitCount() != 0 {
+		t.Error("nobody should be waiting")
+	}
+}
+
+func TestSemaphoreTotals(t *testing.T) {
+	sem := New(2, 10*time.Millisecond)
+
+	sem.Acquire()
+	sem.TryAcquire()
+	sem.Acquire()
+	sem.AcquireN(2)
+	sem.ReleaseN(2)
+	sem.AcquireN(2)
+
+	if sem.TotalAcquired() != 3 {
+		t.Error("expected 3 acquisitions, got", sem.TotalAcquired())
+	}
+	if sem.TotalTimeouts() != 2 {
+		t.Error("expected 2 timeouts, got", sem.TotalTimeouts())
+	}
+}
+
+func TestSemaphoreFastPathContention(t *testing.T) {
+	for _, fair := range []bool{false, true} {
+		opts := []Option{WithTimeout(time.Millisecond)}
+		if fair {
+			opts = append(opts, WithFairness())
+		}
+		sem := NewWithOptions(3, opts...)
+		var over int32
+		wg := &sync.WaitGroup{}
+
+		for i := 0; i < 16; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < 500; j++ {
+					n := 1 + (i+j)%2
+					var ok bool
+					switch j % 3 {
+					case 0:
+						ok = sem.AcquireN(n) == nil
+					case 1:
+						ok = sem.TryAcquireN(n)
+					default:
+						ok, _ = sem.TryAcquireContext(context.Background())
+						n = 1
+					}
+					if !ok {
+						continue
+					}
+					if sem.InUse() > sem.Cap() {
+						atomic.StoreInt32(&over, 1)
+					}
+					sem.ReleaseN(n)
+				}
+			}(i)
+		}
+
+		// switch the slow path on and off while the workers run
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+				sem.Drain(ctx)
+				cancel()
+			}
+		}()
+		wg.Wait()
+
+		if atomic.LoadInt32(&over) != 0 {
+			t.Error("more tickets were held than the ticket-count, fair:", fair)
+		}
+		if !sem.IsEmpty() {
+			t.Error("expected no tickets held, got", sem.InUse())
+		}
+		if err := sem.Drain(context.Background()); err != nil {
+			t.Error(err)
+		}
+		if err := sem.Acquire(); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestSemaphoreAcquireDoesNotAllocate(t *testing.T) {
+	sem := New(1, 1*time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx.Done() // the channel is created lazily, once
+
+	cases := map[string]func() error{
+		"Acquire":        sem.Acquire,
+		"AcquireTimeout": func() error { return sem.AcquireTimeout(time.Second) },
+		"AcquireContext": func() error { return sem.AcquireContext(ctx) },
+		"AcquireN":       func() error { return sem.AcquireN(1) },
+	}
+	for name, acquire := range cases {
+		allocs := testing.AllocsPerRun(100, func() {
+			if err := acquire(); err != nil {
+				t.Fatal(err)
+			}
+			sem.Release()
+		})
+		if allocs != 0 {
+			t.Errorf("%s allocated %v times when a ticket was available", name, allocs)
+		}
+	}
+}
+
+func BenchmarkSemaphoreAcquireRelease(b *testing.B) {
+	sem := New(1, 1*time.Second)
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if err := sem.Acquire(); err != nil {
+			b.Fatal(err)
+		}
+		sem.Release()
+	}
+}
+
+// BenchmarkSemaphoreAcquireReleaseSlowPath forces every operation through the
+// lock by subscribing to events, for comparison with the lock-free fast path
+// measured by BenchmarkSemaphoreAcquireRelease.
+func BenchmarkSemaphoreAcquireReleaseSlowPath(b *testing.B) {
+	sem := New(1, 1*time.Second)
+	sem.Notify()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if err := sem.Acquire(); err != nil {
+			b.Fatal(err)
+		}
+		sem.Release()
+	}
+}
+
+func BenchmarkSemaphoreAcquireContextRelease(b *testing.B) {
+	sem := New(1, 1*time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if err := sem.AcquireContext(ctx); err != nil {
+			b.Fatal(err)
+		}
+		sem.Release()
+	}
+}
+
+func BenchmarkSemaphoreAcquireReleaseParallel(b *testing.B) {
+	sem := New(1000, 1*time.Second)
+	b.ReportAllocs()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := sem.Acquire(); err != nil {
+				b.Fatal(err)
+			}
+			sem.Release()
+		}
+	})
+}
+
+func BenchmarkSemaphoreAcquireWait(b *testing.B) {
+	sem := New(1, 1*time.Second)
+	sem.Acquire()
+	released := make(chan struct{})
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		go func() {
+			sem.Release()
+			released <- struct{}{}
+		}()
+		if err := sem.Acquire(); err != nil {
+			b.Fatal(err)
+		}
+		<-released
+	}
+}
+
 func ExampleSemaphore() {
 	sem := New(3, 1*time.Second)
 
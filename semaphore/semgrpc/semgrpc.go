@@ -0,0 +1,65 @@
+// Package semgrpc limits the number of concurrent in-flight gRPC calls using a
+// semaphore.Semaphore. It lives in its own module so that the semaphore package
+// itself stays free of the gRPC dependency.
+package semgrpc
+
+import (
+	"context"
+	"errors"
+
+	"github.com/eapache/go-resiliency/semaphore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor returns a gRPC interceptor that acquires a ticket from
+// the given semaphore before invoking each unary handler, and releases it once
+// the handler returns (even if it panics). Acquisition respects the incoming
+// call's context. Calls that cannot acquire a ticket, including those turned
+// away by WithMaxWaiters or preempted by PolicyReplaceOldest, are rejected with
+// codes.ResourceExhausted, and calls arriving while the semaphore is closed or
+// paused with codes.Unavailable.
+func UnaryServerInterceptor(sem *semaphore.Semaphore) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := acquire(ctx, sem); err != nil {
+			return nil, err
+		}
+		defer sem.Release()
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor is like UnaryServerInterceptor but for streaming
+// calls. The ticket is held for the lifetime of the stream.
+func StreamServerInterceptor(sem *semaphore.Semaphore) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := acquire(ss.Context(), sem); err != nil {
+			return err
+		}
+		defer sem.Release()
+
+		return handler(srv, ss)
+	}
+}
+
+func acquire(ctx context.Context, sem *semaphore.Semaphore) error {
+	return statusError(sem.AcquireContext(ctx))
+}
+
+// statusError converts an error from AcquireContext into a gRPC status error.
+func statusError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, semaphore.ErrNoTickets),
+		errors.Is(err, semaphore.ErrTooManyWaiters),
+		errors.Is(err, semaphore.ErrPreempted):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, semaphore.ErrClosed), errors.Is(err, semaphore.ErrPaused):
+		return status.Error(codes.Unavailable, err.Error())
+	default:
+		return status.FromContextError(err).Err()
+	}
+}
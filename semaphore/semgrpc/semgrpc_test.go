@@ -0,0 +1,116 @@
+package semgrpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/eapache/go-resiliency/semaphore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type fakeStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (f fakeStream) Context() context.Context {
+	return f.ctx
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	sem := semaphore.New(1, 10*time.Millisecond)
+	interceptor := UnaryServerInterceptor(sem)
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		if sem.InUse() != 1 {
+			t.Error("ticket should be held while the handler runs")
+		}
+		return "ok", nil
+	}
+
+	resp, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{}, handler)
+	if err != nil || resp != "ok" {
+		t.Error(resp, err)
+	}
+	if !sem.IsEmpty() {
+		t.Error("ticket should be released after the handler")
+	}
+
+	sem.Acquire()
+	_, err = interceptor(context.Background(), nil, &grpc.UnaryServerInfo{}, handler)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Error(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = interceptor(ctx, nil, &grpc.UnaryServerInfo{}, handler)
+	if status.Code(err) != codes.Canceled {
+		t.Error(err)
+	}
+	sem.Release()
+}
+
+func TestStatusError(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		code codes.Code
+	}{
+		{nil, codes.OK},
+		{&semaphore.TimeoutError{Name: "db"}, codes.ResourceExhausted},
+		{semaphore.ErrTooManyWaiters, codes.ResourceExhausted},
+		{semaphore.ErrPreempted, codes.ResourceExhausted},
+		{&semaphore.ClosedError{Name: "db"}, codes.Unavailable},
+		{semaphore.ErrPaused, codes.Unavailable},
+		{context.Canceled, codes.Canceled},
+		{context.DeadlineExceeded, codes.DeadlineExceeded},
+	} {
+		if code := status.Code(statusError(tc.err)); code != tc.code {
+			t.Errorf("%v: expected %v, got %v", tc.err, tc.code, code)
+		}
+	}
+}
+
+func TestUnaryServerInterceptorPaused(t *testing.T) {
+	sem := semaphore.New(1, 10*time.Millisecond)
+	interceptor := UnaryServerInterceptor(sem)
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+
+	sem.Pause()
+	if _, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{}, handler); status.Code(err) != codes.Unavailable {
+		t.Error(err)
+	}
+	sem.Resume()
+	if _, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{}, handler); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	sem := semaphore.New(1, 10*time.Millisecond)
+	interceptor := StreamServerInterceptor(sem)
+	stream := fakeStream{ctx: context.Background()}
+	handler := func(srv interface{}, ss grpc.ServerStream) error {
+		if sem.InUse() != 1 {
+			t.Error("ticket should be held while the handler runs")
+		}
+		return nil
+	}
+
+	if err := interceptor(nil, stream, &grpc.StreamServerInfo{}, handler); err != nil {
+		t.Error(err)
+	}
+	if !sem.IsEmpty() {
+		t.Error("ticket should be released after the handler")
+	}
+
+	sem.Acquire()
+	if err := interceptor(nil, stream, &grpc.StreamServerInfo{}, handler); status.Code(err) != codes.ResourceExhausted {
+		t.Error(err)
+	}
+	sem.Release()
+}
@@ -0,0 +1,33 @@
+// Package semhttp limits the number of concurrent in-flight HTTP requests using
+// a semaphore.Semaphore.
+package semhttp
+
+import (
+	"net/http"
+
+	"github.com/eapache/go-resiliency/semaphore"
+)
+
+// RetryAfter is the value of the Retry-After header (in seconds) sent with
+// rejected requests.
+const RetryAfter = "1"
+
+// Middleware returns HTTP middleware that acquires a ticket from the given
+// semaphore before passing each request to the next handler, and releases it
+// once the handler returns (even if it panics). Acquisition respects the
+// request's context. Requests that cannot acquire a ticket are rejected with
+// 503 Service Unavailable and a Retry-After header instead.
+func Middleware(sem *semaphore.Semaphore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := sem.AcquireContext(r.Context()); err != nil {
+				w.Header().Set("Retry-After", RetryAfter)
+				http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+				return
+			}
+			defer sem.Release()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
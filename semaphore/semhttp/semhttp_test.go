@@ -0,0 +1,55 @@
+package semhttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/eapache/go-resiliency/semaphore"
+)
+
+func TestMiddleware(t *testing.T) {
+	sem := semaphore.New(1, 10*time.Millisecond)
+	handler := Middleware(sem)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if sem.InUse() != 1 {
+			t.Error("ticket should be held while the handler runs")
+		}
+		if r.URL.Path == "/panic" {
+			panic("oops")
+		}
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusTeapot {
+		t.Error("wrong status", rec.Code)
+	}
+	if !sem.IsEmpty() {
+		t.Error("ticket should be released after the handler")
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("panic should propagate")
+			}
+		}()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/panic", nil))
+	}()
+	if !sem.IsEmpty() {
+		t.Error("ticket should be released after a panic")
+	}
+
+	sem.Acquire()
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Error("wrong status", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") != RetryAfter {
+		t.Error("missing Retry-After header")
+	}
+	sem.Release()
+}
@@ -0,0 +1,59 @@
+// Package semotel traces semaphore.Semaphore acquisitions with OpenTelemetry.
+// It lives in its own module so that the semaphore package itself stays free
+// of the OpenTelemetry dependency.
+package semotel
+
+import (
+	"context"
+	"time"
+
+	"github.com/eapache/go-resiliency/semaphore"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SpanName is the name of the span started around each traced acquisition.
+const SpanName = "semaphore.acquire"
+
+const instrumentationName = "github.com/eapache/go-resiliency/semaphore/semotel"
+
+// Tracer is a semaphore.Tracer that records acquisitions as OpenTelemetry
+// spans, for use with semaphore.WithTracer. If the context passed to
+// AcquireContext carries an active span, the wait is recorded as a child span
+// named SpanName with attributes for the semaphore's name, the time spent
+// waiting, and the outcome, one of the semaphore.Outcome constants. The span is
+// ended whether or not a ticket was acquired. Without an active span nothing
+// is recorded. Since the tracer is given no semaphore, the name to record is set
+// when constructing it.
+type Tracer struct {
+	name string
+}
+
+// NewTracer constructs a Tracer which records the given semaphore name in the
+// "semaphore.name" attribute of every span.
+func NewTracer(semaphoreName string) *Tracer {
+	return &Tracer{name: semaphoreName}
+}
+
+// StartAcquire implements semaphore.Tracer.
+func (t *Tracer) StartAcquire(ctx context.Context) (context.Context, func(outcome string)) {
+	parent := trace.SpanFromContext(ctx)
+	if !parent.SpanContext().IsValid() {
+		return ctx, func(string) {}
+	}
+
+	ctx, span := parent.TracerProvider().Tracer(instrumentationName).Start(ctx, SpanName)
+	start := time.Now()
+	return ctx, func(outcome string) {
+		span.SetAttributes(
+			attribute.String("semaphore.name", t.name),
+			attribute.Float64("semaphore.wait_seconds", time.Since(start).Seconds()),
+			attribute.String("semaphore.outcome", outcome),
+		)
+		if outcome != semaphore.OutcomeAcquired {
+			span.SetStatus(codes.Error, outcome)
+		}
+		span.End()
+	}
+}
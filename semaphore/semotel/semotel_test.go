@@ -0,0 +1,60 @@
+package semotel
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/eapache/go-resiliency/semaphore"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+
+	var _ semaphore.Tracer = NewTracer("db")
+	sem := semaphore.NewWithOptions(1, semaphore.WithTimeout(10*time.Millisecond), semaphore.WithTracer(NewTracer("db")))
+
+	sem.AcquireContext(ctx)
+	sem.AcquireContext(ctx)
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	sem.AcquireContext(cancelled)
+	sem.Close()
+	sem.AcquireContext(ctx)
+	sem.AcquireContext(context.Background())
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 5 {
+		t.Fatal("expected 5 spans, got", len(spans))
+	}
+	for i, outcome := range []string{"acquired", "timeout", "cancelled", "closed"} {
+		span := spans[i]
+		if span.Name() != SpanName {
+			t.Error("wrong span name", span.Name())
+		}
+		if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Error("span is not a child of the active span")
+		}
+		if !hasAttribute(span.Attributes(), attribute.String("semaphore.outcome", outcome)) {
+			t.Error("missing outcome", outcome)
+		}
+		if !hasAttribute(span.Attributes(), attribute.String("semaphore.name", "db")) {
+			t.Error("missing name")
+		}
+	}
+}
+
+func hasAttribute(attrs []attribute.KeyValue, want attribute.KeyValue) bool {
+	for _, attr := range attrs {
+		if attr == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+// Package semprom exports the state of a semaphore.Semaphore as Prometheus
+// metrics. It lives in its own module so that the semaphore package itself
+// stays free of the Prometheus dependency.
+package semprom
+
+import (
+	"github.com/eapache/go-resiliency/semaphore"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector implements prometheus.Collector for a single semaphore, labelling
+// every metric with the semaphore's name.
+type Collector struct {
+	sem *semaphore.Semaphore
+
+	capacity, inUse, available, waiting *prometheus.Desc
+	acquired, timeouts                  *prometheus.Desc
+}
+
+// NewCollector constructs a Collector exporting the metrics of the given
+// semaphore. Register it with a prometheus.Registerer to start scraping.
+func NewCollector(sem *semaphore.Semaphore) *Collector {
+	labels := prometheus.Labels{"name": sem.Name()}
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName("semaphore", "", name), help, nil, labels)
+	}
+
+	return &Collector{
+		sem:       sem,
+		capacity:  desc("capacity", "Total number of tickets the semaphore hands out."),
+		inUse:     desc("in_use", "Number of tickets currently held."),
+		available: desc("available", "Number of tickets currently available."),
+		waiting:   desc("waiting", "Number of callers currently waiting for a ticket."),
+		acquired:  desc("acquired_total", "Total number of successful acquisitions."),
+		timeouts:  desc("timeouts_total", "Total number of acquisitions that timed out."),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.capacity
+	ch <- c.inUse
+	ch <- c.available
+	ch <- c.waiting
+	ch <- c.acquired
+	ch <- c.timeouts
+}
+
+// Collect implements prometheus.Collector. The metrics are all read from a
+// single Stats snapshot, as by semaphore.WriteOpenMetrics, so the gauges are
+// consistent with each other and match what that exports.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.sem.Stats()
+	ch <- prometheus.MustNewConstMetric(c.capacity, prometheus.GaugeValue, float64(stats.Capacity))
+	ch <- prometheus.MustNewConstMetric(c.inUse, prometheus.GaugeValue, float64(stats.InUse))
+	ch <- prometheus.MustNewConstMetric(c.available, prometheus.GaugeValue, float64(stats.Available))
+	ch <- prometheus.MustNewConstMetric(c.waiting, prometheus.GaugeValue, float64(stats.Waiting))
+	ch <- prometheus.MustNewConstMetric(c.acquired, prometheus.CounterValue, float64(stats.TotalAcquired))
+	ch <- prometheus.MustNewConstMetric(c.timeouts, prometheus.CounterValue, float64(stats.TotalTimeouts))
+}
@@ -0,0 +1,40 @@
+package semprom
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eapache/go-resiliency/semaphore"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollector(t *testing.T) {
+	sem := semaphore.NewWithOptions(2, semaphore.WithName("db"), semaphore.WithTimeout(10*time.Millisecond))
+	sem.AcquireN(2)
+	sem.Acquire()
+
+	expected := `
+# HELP semaphore_acquired_total Total number of successful acquisitions.
+# TYPE semaphore_acquired_total counter
+semaphore_acquired_total{name="db"} 1
+# HELP semaphore_available Number of tickets currently available.
+# TYPE semaphore_available gauge
+semaphore_available{name="db"} 0
+# HELP semaphore_capacity Total number of tickets the semaphore hands out.
+# TYPE semaphore_capacity gauge
+semaphore_capacity{name="db"} 2
+# HELP semaphore_in_use Number of tickets currently held.
+# TYPE semaphore_in_use gauge
+semaphore_in_use{name="db"} 2
+# HELP semaphore_timeouts_total Total number of acquisitions that timed out.
+# TYPE semaphore_timeouts_total counter
+semaphore_timeouts_total{name="db"} 1
+# HELP semaphore_waiting Number of callers currently waiting for a ticket.
+# TYPE semaphore_waiting gauge
+semaphore_waiting{name="db"} 0
+`
+	if err := testutil.CollectAndCompare(NewCollector(sem), strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
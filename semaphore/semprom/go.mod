@@ -0,0 +1,10 @@
+module github.com/eapache/go-resiliency/semaphore/semprom
+
+go 1.13
+
+require (
+	github.com/eapache/go-resiliency v1.4.0
+	github.com/prometheus/client_golang v1.11.1
+)
+
+replace github.com/eapache/go-resiliency => ../..
@@ -0,0 +1,62 @@
+//go:build go1.21
+// +build go1.21
+
+package semaphore
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// WithLogger makes the semaphore log its notable events to the given logger: a
+// debug-level record whenever an acquisition times out, and info-level records
+// when the semaphore is closed or drained. Each record carries the semaphore's
+// name and its current number of held tickets and waiters, and timeouts also
+// carry how long the caller waited. Logging is implemented as lifecycle hooks,
+// so it combines with any hooks added by WithOnTimeout. A nil logger is ignored.
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *Semaphore) {
+		if logger == nil {
+			return
+		}
+
+		log := func(level slog.Level, msg string, attrs ...slog.Attr) {
+			ctx := context.Background()
+			if !logger.Enabled(ctx, level) {
+				return
+			}
+			stats := s.Stats()
+			attrs = append(attrs,
+				slog.String("name", s.name),
+				slog.Int("in_use", stats.InUse),
+				slog.Int("waiting", stats.Waiting),
+			)
+			logger.LogAttrs(ctx, level, msg, attrs...)
+		}
+
+		s.onTimeout = chainWaited(s.onTimeout, func(waited time.Duration) {
+			log(slog.LevelDebug, "semaphore acquisition timed out", slog.Duration("waited", waited))
+		})
+		s.onClose = chain(s.onClose, func() {
+			log(slog.LevelInfo, "semaphore closed")
+		})
+		s.onDrain = chainErr(s.onDrain, func(err error) {
+			if err != nil {
+				log(slog.LevelInfo, "semaphore drain abandoned", slog.Any("error", err))
+			} else {
+				log(slog.LevelInfo, "semaphore drained")
+			}
+		})
+	}
+}
+
+func chainErr(first, second func(error)) func(error) {
+	if first == nil {
+		return second
+	}
+	return func(err error) {
+		first(err)
+		second(err)
+	}
+}
@@ -0,0 +1,57 @@
+//go:build go1.21
+// +build go1.21
+
+package semaphore
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	timeouts := 0
+	sem := NewWithOptions(1,
+		WithName("db"),
+		WithTimeout(10*time.Millisecond),
+		WithOnTimeout(func(time.Duration) { timeouts++ }),
+		WithLogger(logger),
+	)
+
+	sem.Acquire()
+	sem.Acquire()
+	if timeouts != 1 {
+		t.Error("existing timeout hook should still be called")
+	}
+	sem.Close()
+	sem.Release()
+	sem.Drain(context.Background())
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatal("expected 3 log lines, got", lines)
+	}
+	for i, expected := range []string{
+		`level=DEBUG msg="semaphore acquisition timed out" waited=`,
+		`level=INFO msg="semaphore closed" name=db in_use=1 waiting=0`,
+		`level=INFO msg="semaphore drained" name=db in_use=0 waiting=0`,
+	} {
+		if !strings.Contains(lines[i], expected) {
+			t.Errorf("line %d: expected %q in %q", i, expected, lines[i])
+		}
+	}
+	if !strings.Contains(lines[0], "name=db in_use=1 waiting=0") {
+		t.Error("timeout should carry the semaphore state:", lines[0])
+	}
+
+	// a nil logger costs nothing
+	if sem := NewWithOptions(1, WithLogger(nil)); sem.onTimeout != nil || sem.onClose != nil || sem.onDrain != nil {
+		t.Error("nil logger should not install hooks")
+	}
+}
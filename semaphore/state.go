@@ -0,0 +1,46 @@
+package semaphore
+
+// State is the part of the state of a Semaphore that is carried over from one
+// instance to another by Snapshot and RestoreFrom.
+type State struct {
+	// Capacity is the total ticket-count of the semaphore.
+	Capacity int
+	// InUse is the number of tickets being held.
+	InUse int
+}
+
+// Snapshot returns the current ticket-count of the semaphore and the number of
+// tickets held, for constructing a replacement with RestoreFrom. It is safe to
+// call Snapshot concurrently with all other methods on a single Semaphore,
+// though the result is only meaningful for a quiescent handoff as described by
+// RestoreFrom.
+func (s *Semaphore) Snapshot() State {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return State{Capacity: s.loadTickets(), InUse: s.loadHeld()}
+}
+
+// RestoreFrom constructs a new Semaphore as if by NewWithOptions with
+// state.Capacity tickets, except that state.InUse of them start out held, so
+// that a semaphore can be reconfigured with different options without
+// double-counting work that is already in flight. Only the counts are carried
+// over; statistics, waiters, leak tracking and everything set by options are
+// not.
+//
+// This is only correct under narrow conditions that the caller must ensure. The
+// handoff must be quiescent: nothing may acquire from or release to the old
+// semaphore between taking the snapshot and switching every caller over to the
+// new one, typically by closing the old semaphore first. And every holder of a
+// ticket counted in state.InUse must afterwards release it to the new
+// semaphore rather than the old one; a holder that releases to the old one
+// leaves the new one with a ticket that is never returned. InUse may exceed
+// Capacity, in which case the new semaphore behaves as if it had been shrunk
+// with Resize.
+func RestoreFrom(state State, opts ...Option) *Semaphore {
+	s := NewWithOptions(state.Capacity, opts...)
+	if state.InUse > 0 {
+		s.held = int64(state.InUse)
+	}
+	return s
+}
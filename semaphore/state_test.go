@@ -0,0 +1,40 @@
+package semaphore
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSemaphoreSnapshotRestore(t *testing.T) {
+	old := New(3, 0)
+	old.AcquireN(2)
+	old.Close()
+
+	state := old.Snapshot()
+	if state.Capacity != 3 || state.InUse != 2 {
+		t.Fatalf("wrong snapshot: %+v", state)
+	}
+
+	sem := RestoreFrom(state, WithName("new"), WithTimeout(10*time.Millisecond))
+	if sem.Name() != "new" || sem.Cap() != 3 || sem.InUse() != 2 {
+		t.Error("semaphore not restored as requested", sem.Name(), sem.Cap(), sem.InUse())
+	}
+	if err := sem.Acquire(); err != nil {
+		t.Error(err)
+	}
+	if err := sem.Acquire(); !errors.Is(err, ErrNoTickets) {
+		t.Error(err)
+	}
+
+	// the in-flight holders release to the new semaphore
+	sem.ReleaseN(3)
+	if !sem.IsEmpty() {
+		t.Error("semaphore should be empty")
+	}
+
+	shrunk := RestoreFrom(State{Capacity: 1, InUse: 2})
+	if shrunk.Available() != 0 || shrunk.TryAcquire() {
+		t.Error("an over-full semaphore should have no tickets available")
+	}
+}
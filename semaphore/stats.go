@@ -0,0 +1,111 @@
+package semaphore
+
+import "sync/atomic"
+
+// Stats is a snapshot of the state of a Semaphore, as returned by its Stats
+// method.
+type Stats struct {
+	// Capacity is the total ticket-count of the semaphore.
+	Capacity int
+	// InUse is the number of tickets being held.
+	InUse int
+	// Available is the number of tickets that could be acquired.
+	Available int
+	// Waiting is the number of callers waiting for tickets.
+	Waiting int
+	// TotalAcquired is the number of successful acquisitions since the
+	// semaphore was constructed.
+	TotalAcquired uint64
+	// TotalTimeouts is the number of acquisitions that have timed out since
+	// the semaphore was constructed, as counted by Counters.TimedOut.
+	TotalTimeouts uint64
+	// TotalAttempted, TotalCancelled, TotalRejected and TotalRefused are the
+	// corresponding counters described by Counters.
+	TotalAttempted uint64
+	TotalCancelled uint64
+	TotalRejected  uint64
+	TotalRefused   uint64
+}
+
+// Counters holds the cumulative outcome counters of a Semaphore, as returned by
+// its CountersSnapshot method. Every call to an acquire method, blocking or not,
+// counts exactly once, under the outcome it returned. There are two exceptions:
+// calls asking for zero tickets or fewer are only counted if they fail because
+// the semaphore is closed, and AcquireWithRetry counts each of its attempts. The
+// counters only ever increase, unless reset, so rates can be computed from them
+// for alerting.
+type Counters struct {
+	// Attempted is the total of all the other counters.
+	Attempted uint64
+	// Acquired counts acquisitions that succeeded.
+	Acquired uint64
+	// TimedOut counts acquisitions that found no ticket within their timeout,
+	// including those with no timeout to wait for and non-blocking ones that
+	// found no ticket free.
+	TimedOut uint64
+	// Cancelled counts acquisitions that were abandoned because their context
+	// was done or their stop channel was closed.
+	Cancelled uint64
+	// Rejected counts acquisitions that a policy refused to let wait: those
+	// turned away by PolicyReject or by WithShedWhenUnhealthy, which fail with
+	// ErrNoTickets without waiting, and those that failed with
+	// ErrTooManyWaiters or ErrPreempted.
+	Rejected uint64
+	// Refused counts acquisitions that failed because the semaphore was closed
+	// or paused, or because they asked for more tickets than it has, failing
+	// with ErrTooManyTickets.
+	Refused uint64
+}
+
+// Stats returns a snapshot of the current state of the semaphore. Capacity,
+// InUse, Available and Waiting are read together and so are always consistent
+// with each other; the cumulative totals are read separately and may be very
+// slightly ahead of or behind them. It is safe to call Stats concurrently with
+// all other methods on a single Semaphore.
+func (s *Semaphore) Stats() Stats {
+	s.lock.Lock()
+	stats := Stats{
+		Capacity: s.loadTickets(),
+		InUse:    s.loadHeld(),
+		Waiting:  s.waiters.Len(),
+	}
+	s.lock.Unlock()
+
+	if stats.InUse < stats.Capacity {
+		stats.Available = stats.Capacity - stats.InUse
+	}
+	counters := s.CountersSnapshot(false)
+	stats.TotalAcquired = counters.Acquired
+	stats.TotalTimeouts = counters.TimedOut
+	stats.TotalAttempted = counters.Attempted
+	stats.TotalCancelled = counters.Cancelled
+	stats.TotalRejected = counters.Rejected
+	stats.TotalRefused = counters.Refused
+	return stats
+}
+
+// CountersSnapshot returns the semaphore's outcome counters. If reset is true
+// they are also set back to zero, including TotalAcquired and TotalTimeouts,
+// with each counter read and reset in a single atomic step so that no outcome
+// is ever lost or counted twice between successive snapshots; the counters are
+// read one after another, though, so they may not all describe the same
+// instant. It is safe to call CountersSnapshot concurrently with all other
+// methods on a single Semaphore.
+func (s *Semaphore) CountersSnapshot(reset bool) Counters {
+	read := atomic.LoadUint64
+	if reset {
+		read = func(addr *uint64) uint64 {
+			return atomic.SwapUint64(addr, 0)
+		}
+	}
+
+	counters := Counters{
+		Acquired:  read(&s.acquired),
+		TimedOut:  read(&s.timeouts),
+		Cancelled: read(&s.cancels),
+		Rejected:  read(&s.rejects),
+		Refused:   read(&s.refusals),
+	}
+	counters.Attempted = counters.Acquired + counters.TimedOut + counters.Cancelled + counters.Rejected + counters.Refused
+	return counters
+}
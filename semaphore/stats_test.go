@@ -0,0 +1,101 @@
+package semaphore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSemaphoreStats(t *testing.T) {
+	sem := New(2, 10*time.Millisecond)
+
+	if stats := sem.Stats(); stats != (Stats{Capacity: 2, Available: 2}) {
+		t.Error("wrong stats for new semaphore", stats)
+	}
+
+	sem.AcquireN(2)
+	sem.Acquire()
+
+	done := make(chan error)
+	go func() {
+		done <- sem.AcquireTimeout(1 * time.Second)
+	}()
+	for sem.WaitCount() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	expected := Stats{
+		Capacity:       2,
+		InUse:          2,
+		Available:      0,
+		Waiting:        1,
+		TotalAcquired:  1,
+		TotalTimeouts:  1,
+		TotalAttempted: 2,
+	}
+	if stats := sem.Stats(); stats != expected {
+		t.Error("wrong stats while waiting", stats)
+	}
+
+	sem.Release()
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+
+	expected.Waiting = 0
+	expected.TotalAcquired = 2
+	expected.TotalAttempted = 3
+	if stats := sem.Stats(); stats != expected {
+		t.Error("wrong stats after hand-over", stats)
+	}
+}
+
+func TestSemaphoreCounters(t *testing.T) {
+	sem := NewWithOptions(1, WithTimeout(time.Millisecond), WithMaxWaiters(1))
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	sem.Acquire()                            // acquired
+	sem.Acquire()                            // timed out
+	sem.TryAcquire()                         // timed out
+	sem.AcquireN(2)                          // refused
+	sem.AcquireContext(cancelled)            // cancelled
+	sem.TryAcquireContext(cancelled)         // cancelled
+	sem.AcquireWithStop(make(chan struct{})) // timed out
+	sem.AcquireN(0)                          // not counted
+
+	waiting := make(chan error)
+	go func() {
+		waiting <- sem.AcquireTimeout(time.Second)
+	}()
+	for sem.WaitCount() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	sem.AcquireTimeout(time.Second) // rejected
+	sem.Pause()
+	<-waiting        // refused
+	sem.TryAcquire() // refused
+	sem.Resume()
+	sem.Close()
+	sem.Acquire()      // refused
+	sem.AcquireN(0)    // refused
+	sem.TryAcquireN(0) // refused
+
+	expected := Counters{Attempted: 13, Acquired: 1, TimedOut: 3, Cancelled: 2, Rejected: 1, Refused: 6}
+	if counters := sem.CountersSnapshot(false); counters != expected {
+		t.Errorf("wrong counters %+v", counters)
+	}
+	if stats := sem.Stats(); stats.TotalAttempted != 13 || stats.TotalRejected != 1 || stats.TotalRefused != 6 || stats.TotalCancelled != 2 {
+		t.Errorf("wrong stats %+v", stats)
+	}
+
+	if counters := sem.CountersSnapshot(true); counters != expected {
+		t.Errorf("wrong counters %+v", counters)
+	}
+	if counters := sem.CountersSnapshot(false); counters != (Counters{}) {
+		t.Errorf("counters should have been reset %+v", counters)
+	}
+	if sem.TotalAcquired() != 0 {
+		t.Error("resetting the counters should reset TotalAcquired")
+	}
+}
@@ -0,0 +1,138 @@
+package semaphore
+
+import (
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+// Ticket is a handle to a single ticket acquired from a Semaphore. It makes
+// the "release exactly once" contract explicit: releasing a Ticket more than
+// once has no further effect. A Ticket is not tied to the goroutine that
+// acquired it, so it may be handed off along with the work it guards and
+// released by whichever goroutine finishes that work; a release through the
+// Ticket always corresponds to a real outstanding acquisition, while stray
+// releases made directly on the semaphore can still be caught with TryRelease.
+type Ticket struct {
+	sem   *Semaphore
+	once  sync.Once
+	stack []byte // where the ticket was acquired, if leak tracking is enabled
+}
+
+// TestingT is the subset of testing.TB used by AssertNoLeaks.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// DrainError is the error returned by Drain, for a semaphore constructed with
+// WithLeakTracking, if its context is done while tickets are still held. It
+// wraps the context's error, so errors.Is(err, context.DeadlineExceeded) still
+// reports whether the drain timed out.
+type DrainError struct {
+	// Name is the name of the semaphore, as set by WithName.
+	Name string
+	// Held is the number of tickets that were still held.
+	Held int
+	// Stacks holds the stack trace of every Ticket that was acquired with
+	// AcquireTicket but not yet released. Tickets acquired by other means are
+	// counted in Held but have no stack trace.
+	Stacks [][]byte
+	// Err is the context's error.
+	Err error
+}
+
+func (e *DrainError) Error() string {
+	var stacks strings.Builder
+	for _, stack := range e.Stacks {
+		fmt.Fprintf(&stacks, "\nticket acquired at:\n%s", stack)
+	}
+	return fmt.Sprintf("%sdrain: %v with %d ticket(s) still held%s", namePrefix(e.Name), e.Err, e.Held, stacks.String())
+}
+
+// Unwrap returns the context's error.
+func (e *DrainError) Unwrap() error {
+	return e.Err
+}
+
+// AcquireTicket tries to acquire a ticket from the semaphore as if by calling
+// Acquire, but returns a handle to the acquired ticket instead of requiring a
+// matching call to the semaphore's Release. It is safe to call AcquireTicket
+// concurrently on a single Semaphore.
+func (s *Semaphore) AcquireTicket() (*Ticket, error) {
+	if err := s.Acquire(); err != nil {
+		return nil, err
+	}
+	return s.newTicket(), nil
+}
+
+// Release releases the ticket back to the semaphore it was acquired from. Only
+// the first call has any effect; subsequent calls are no-ops. It may be called
+// from any goroutine, not only the one that acquired the ticket, and it is safe
+// to call Release concurrently on a single Ticket.
+func (t *Ticket) Release() {
+	t.once.Do(func() {
+		t.sem.untrack(t)
+		t.sem.Release()
+	})
+}
+
+// AssertNoLeaks fails the test if the semaphore has any tickets held. If the
+// semaphore was constructed with WithLeakTracking, the failure includes the
+// stack trace of every Ticket that was acquired but not yet released. It is
+// meant to be deferred at the start of a test, once the semaphore is created.
+func (s *Semaphore) AssertNoLeaks(t TestingT) {
+	t.Helper()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.loadHeld() == 0 {
+		return
+	}
+
+	var stacks strings.Builder
+	for ticket := range s.tracked {
+		fmt.Fprintf(&stacks, "\nticket acquired at:\n%s", ticket.stack)
+	}
+	t.Errorf("semaphore has %d leaked ticket(s)%s", s.loadHeld(), stacks.String())
+}
+
+// drainError returns the error for a Drain that was interrupted by err with held
+// tickets still held, which is a *DrainError if leak tracking is enabled and err
+// unchanged otherwise.
+func (s *Semaphore) drainError(err error, held int) error {
+	if s.tracked == nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	stacks := make([][]byte, 0, len(s.tracked))
+	for ticket := range s.tracked {
+		stacks = append(stacks, ticket.stack)
+	}
+	return &DrainError{Name: s.name, Held: held, Stacks: stacks, Err: err}
+}
+
+func (s *Semaphore) newTicket() *Ticket {
+	t := &Ticket{sem: s}
+	if s.tracked != nil {
+		t.stack = debug.Stack()
+
+		s.lock.Lock()
+		s.tracked[t] = struct{}{}
+		s.lock.Unlock()
+	}
+	return t
+}
+
+func (s *Semaphore) untrack(t *Ticket) {
+	if s.tracked != nil {
+		s.lock.Lock()
+		delete(s.tracked, t)
+		s.lock.Unlock()
+	}
+}
@@ -0,0 +1,168 @@
+package semaphore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSemaphoreAcquireTicket(t *testing.T) {
+	sem := New(2, 50*time.Millisecond)
+
+	t1, err := sem.AcquireTicket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t2, err := sem.AcquireTicket()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if t3, err := sem.AcquireTicket(); !errors.Is(err, ErrNoTickets) || t3 != nil {
+		t.Error(err)
+	}
+
+	t1.Release()
+	t1.Release()
+	if sem.InUse() != 1 {
+		t.Error("releasing a ticket twice should only release once")
+	}
+
+	t2.Release()
+	if !sem.IsEmpty() {
+		t.Error("semaphore should be empty")
+	}
+}
+
+type fakeT struct {
+	failures []string
+}
+
+func (f *fakeT) Helper() {}
+
+func (f *fakeT) Errorf(format string, args ...interface{}) {
+	f.failures = append(f.failures, fmt.Sprintf(format, args...))
+}
+
+func leakTicket(sem *Semaphore) {
+	sem.AcquireTicket()
+}
+
+func TestSemaphoreTicketHandoff(t *testing.T) {
+	sem := NewWithOptions(4, WithTimeout(time.Second), WithLeakTracking())
+	tickets := make(chan *Ticket)
+
+	var acquirers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		acquirers.Add(1)
+		go func() {
+			defer acquirers.Done()
+			for j := 0; j < 100; j++ {
+				ticket, err := sem.AcquireTicket()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				tickets <- ticket
+			}
+		}()
+	}
+
+	var releasers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		releasers.Add(1)
+		go func() {
+			defer releasers.Done()
+			for ticket := range tickets {
+				// hand off again, and race two releases of the same ticket
+				var both sync.WaitGroup
+				both.Add(2)
+				for k := 0; k < 2; k++ {
+					go func() {
+						defer both.Done()
+						ticket.Release()
+					}()
+				}
+				both.Wait()
+			}
+		}()
+	}
+
+	acquirers.Wait()
+	close(tickets)
+	releasers.Wait()
+
+	sem.AssertNoLeaks(t)
+	if sem.TotalAcquired() != 400 {
+		t.Error(sem.TotalAcquired())
+	}
+	if err := sem.TryRelease(); err != ErrNotAcquired {
+		t.Error("stray release should still be caught, got", err)
+	}
+}
+
+func TestSemaphoreAssertNoLeaks(t *testing.T) {
+	sem := NewWithOptions(2, WithLeakTracking())
+	defer sem.AssertNoLeaks(t)
+
+	ticket, _ := sem.AcquireTicket()
+	leakTicket(sem)
+
+	ft := &fakeT{}
+	sem.AssertNoLeaks(ft)
+	if len(ft.failures) != 1 {
+		t.Fatal("expected a leak to be reported")
+	}
+	if !strings.Contains(ft.failures[0], "2 leaked ticket(s)") {
+		t.Error("wrong leak count reported:", ft.failures[0])
+	}
+	if strings.Count(ft.failures[0], "ticket acquired at:") != 2 {
+		t.Error("expected both stacks to be reported:", ft.failures[0])
+	}
+	if !strings.Contains(ft.failures[0], "leakTicket") {
+		t.Error("stack should point at the leak:", ft.failures[0])
+	}
+
+	ticket.Release()
+	ft = &fakeT{}
+	sem.AssertNoLeaks(ft)
+	if len(ft.failures) != 1 || strings.Count(ft.failures[0], "ticket acquired at:") != 1 {
+		t.Error("expected only the remaining leak to be reported:", ft.failures)
+	}
+
+	sem.Release()
+}
+
+func TestSemaphoreDrainError(t *testing.T) {
+	sem := NewWithOptions(2, WithName("db"), WithLeakTracking())
+	leakTicket(sem)
+	sem.Acquire()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := sem.Drain(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal(err)
+	}
+	var drainErr *DrainError
+	if !errors.As(err, &drainErr) {
+		t.Fatal("expected a DrainError, got", err)
+	}
+	if drainErr.Name != "db" || drainErr.Held != 2 || len(drainErr.Stacks) != 1 {
+		t.Errorf("wrong drain error details: %+v", drainErr)
+	}
+	if !strings.Contains(err.Error(), "2 ticket(s) still held") || !strings.Contains(err.Error(), "leakTicket") {
+		t.Error("error should point at the leak:", err)
+	}
+
+	// without leak tracking the context's error is returned unchanged
+	plain := New(1, 0)
+	plain.Acquire()
+	if err := plain.Drain(ctx); err != context.DeadlineExceeded {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,51 @@
+package semaphore
+
+import (
+	"context"
+	"errors"
+)
+
+// The outcomes passed to the finish function returned by Tracer.StartAcquire.
+const (
+	OutcomeAcquired  = "acquired"
+	OutcomeTimeout   = "timeout"
+	OutcomeCancelled = "cancelled"
+	OutcomeClosed    = "closed"
+	// OutcomeError covers any other failure, such as ErrTooManyWaiters.
+	OutcomeError = "error"
+)
+
+// Tracer instruments acquisitions made with AcquireContext, so that waits can be
+// traced with any tracing backend; the semotel package provides one for
+// OpenTelemetry. StartAcquire is called when an acquisition starts, and returns
+// the context to acquire with, which may carry a new span, and a function that
+// is called exactly once when the acquisition finishes with one of the Outcome
+// constants. Implementations must be safe for concurrent use.
+type Tracer interface {
+	StartAcquire(ctx context.Context) (context.Context, func(outcome string))
+}
+
+// NopTracer is a Tracer that does nothing. It is the default; there is no need
+// to set it explicitly except to switch off a Tracer chosen elsewhere.
+type NopTracer struct{}
+
+// StartAcquire implements Tracer.
+func (NopTracer) StartAcquire(ctx context.Context) (context.Context, func(outcome string)) {
+	return ctx, func(string) {}
+}
+
+// traceOutcome classifies the result of an acquisition for a Tracer.
+func traceOutcome(err error) string {
+	switch {
+	case err == nil:
+		return OutcomeAcquired
+	case errors.Is(err, ErrNoTickets):
+		return OutcomeTimeout
+	case errors.Is(err, ErrClosed):
+		return OutcomeClosed
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return OutcomeCancelled
+	default:
+		return OutcomeError
+	}
+}
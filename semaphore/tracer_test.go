@@ -0,0 +1,70 @@
+package semaphore
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+type traceKey struct{}
+
+type recordingTracer struct {
+	lock     sync.Mutex
+	outcomes []string
+}
+
+func (r *recordingTracer) StartAcquire(ctx context.Context) (context.Context, func(outcome string)) {
+	ctx = context.WithValue(ctx, traceKey{}, r)
+	return ctx, func(outcome string) {
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		r.outcomes = append(r.outcomes, outcome)
+	}
+}
+
+func TestSemaphoreTracer(t *testing.T) {
+	tracer := &recordingTracer{}
+	sem := NewWithOptions(1, WithTimeout(10*time.Millisecond), WithMaxWaiters(1), WithTracer(tracer))
+
+	sem.AcquireContext(context.Background())
+	sem.AcquireContext(context.Background())
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	sem.AcquireContext(cancelled)
+
+	waiting := make(chan error)
+	go func() {
+		waiting <- sem.AcquireTimeout(time.Second)
+	}()
+	for sem.WaitCount() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	sem.AcquireContext(context.Background())
+
+	sem.Close()
+	<-waiting
+	sem.AcquireContext(context.Background())
+
+	expected := []string{OutcomeAcquired, OutcomeTimeout, OutcomeCancelled, OutcomeError, OutcomeClosed}
+	if len(tracer.outcomes) != len(expected) {
+		t.Fatal(tracer.outcomes)
+	}
+	for i := range expected {
+		if tracer.outcomes[i] != expected[i] {
+			t.Errorf("outcome %d: expected %s, got %s", i, expected[i], tracer.outcomes[i])
+		}
+	}
+
+	// plain Acquire is not traced, and a NopTracer disables tracing
+	sem = NewWithOptions(1, WithTracer(tracer), WithTracer(NopTracer{}))
+	if sem.tracer != nil {
+		t.Error("NopTracer should not be installed")
+	}
+	ctx, finish := NopTracer{}.StartAcquire(context.Background())
+	finish(OutcomeAcquired)
+	if ctx != context.Background() {
+		t.Error("NopTracer should not change the context")
+	}
+}
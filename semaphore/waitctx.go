@@ -0,0 +1,25 @@
+package semaphore
+
+import (
+	"context"
+	"time"
+)
+
+type waitDurationKey struct{}
+
+// ContextWithWaitDuration returns a copy of ctx carrying the given duration as
+// the time spent waiting for a semaphore, for WaitDurationFromContext to
+// retrieve. DoContext does this automatically; callers using AcquireContext
+// directly can time the call and use this to pass the result on in the same way.
+func ContextWithWaitDuration(ctx context.Context, waited time.Duration) context.Context {
+	return context.WithValue(ctx, waitDurationKey{}, waited)
+}
+
+// WaitDurationFromContext returns how long was spent waiting for a semaphore
+// ticket, as carried by a context passed to the work function of DoContext or
+// created by ContextWithWaitDuration. The boolean is false if the context
+// carries no such duration.
+func WaitDurationFromContext(ctx context.Context) (time.Duration, bool) {
+	waited, ok := ctx.Value(waitDurationKey{}).(time.Duration)
+	return waited, ok
+}
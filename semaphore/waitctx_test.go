@@ -0,0 +1,34 @@
+package semaphore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWaitDurationFromContext(t *testing.T) {
+	if _, ok := WaitDurationFromContext(context.Background()); ok {
+		t.Error("plain context should carry no wait duration")
+	}
+	ctx := ContextWithWaitDuration(context.Background(), time.Second)
+	if waited, ok := WaitDurationFromContext(ctx); !ok || waited != time.Second {
+		t.Error(waited, ok)
+	}
+
+	sem := New(1, 1*time.Second)
+	sem.Acquire()
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		sem.Release()
+	}()
+
+	var waited time.Duration
+	var ok bool
+	sem.DoContext(context.Background(), func(ctx context.Context) error {
+		waited, ok = WaitDurationFromContext(ctx)
+		return nil
+	})
+	if !ok || waited < 20*time.Millisecond {
+		t.Error("DoContext should report how long it waited, got", waited, ok)
+	}
+}
@@ -0,0 +1,43 @@
+package semaphore
+
+import "time"
+
+// WaiterInfo describes a caller waiting for tickets, as returned by
+// DumpWaiters.
+type WaiterInfo struct {
+	// Tickets is the number of tickets the caller is waiting for.
+	Tickets int
+	// Priority is the priority the caller is waiting at.
+	Priority int
+	// Since is when the caller started waiting.
+	Since time.Time
+	// Stack is the stack trace of the caller, or nil unless the semaphore was
+	// constructed with WithWaiterStacks.
+	Stack []byte
+}
+
+// DumpWaiters returns a description of every caller currently waiting for
+// tickets, in the order they will be served, or nil if nobody is waiting. It is
+// meant for debugging hangs: wired up to a signal handler or debug endpoint, it
+// shows on-call engineers who is stuck in the queue and, if the semaphore was
+// constructed with WithWaiterStacks, where. It is safe to call DumpWaiters
+// concurrently with all other methods on a single Semaphore.
+func (s *Semaphore) DumpWaiters() []WaiterInfo {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.waiters.Len() == 0 {
+		return nil
+	}
+	infos := make([]WaiterInfo, 0, s.waiters.Len())
+	for elem := s.waiters.Front(); elem != nil; elem = elem.Next() {
+		w := elem.Value.(*waiter)
+		infos = append(infos, WaiterInfo{
+			Tickets:  w.n,
+			Priority: w.priority,
+			Since:    w.since,
+			Stack:    w.stack,
+		})
+	}
+	return infos
+}
@@ -0,0 +1,60 @@
+package semaphore
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func blockedWaiter(sem *Semaphore, done chan<- error) {
+	done <- sem.AcquireN(2)
+}
+
+func TestSemaphoreDumpWaiters(t *testing.T) {
+	for _, stacks := range []bool{false, true} {
+		opts := []Option{WithTimeout(time.Second)}
+		if stacks {
+			opts = append(opts, WithWaiterStacks())
+		}
+		sem := NewWithOptions(2, opts...)
+		if sem.DumpWaiters() != nil {
+			t.Error("nobody is waiting")
+		}
+		sem.AcquireN(2)
+
+		done := make(chan error)
+		before := time.Now()
+		go blockedWaiter(sem, done)
+		for sem.WaitCount() != 1 {
+			time.Sleep(time.Millisecond)
+		}
+		go func() {
+			done <- sem.AcquireWithPriority(1)
+		}()
+		for sem.WaitCount() != 2 {
+			time.Sleep(time.Millisecond)
+		}
+
+		waiters := sem.DumpWaiters()
+		if len(waiters) != 2 {
+			t.Fatal(waiters)
+		}
+		// the priority waiter is served first
+		if waiters[0].Priority != 1 || waiters[0].Tickets != 1 || waiters[1].Tickets != 2 {
+			t.Error(waiters)
+		}
+		if waiters[1].Since.Before(before) || waiters[1].Since.After(waiters[0].Since) {
+			t.Error("wrong enqueue times", waiters)
+		}
+		if stacks != strings.Contains(string(waiters[1].Stack), "blockedWaiter") {
+			t.Errorf("stacks %v, got %q", stacks, waiters[1].Stack)
+		}
+
+		sem.Close()
+		<-done
+		<-done
+		if sem.DumpWaiters() != nil {
+			t.Error("nobody is waiting")
+		}
+	}
+}
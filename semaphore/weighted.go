@@ -0,0 +1,99 @@
+package semaphore
+
+import (
+	"context"
+	"time"
+)
+
+// maxInt is the largest weight a WeightedSemaphore can hold on this platform.
+const maxInt = int64(^uint(0) >> 1)
+
+// WeightedSemaphore is a semaphore with a budget of weight rather than a count
+// of tickets, for limiting resources such as memory or bytes in flight where
+// each caller needs a different amount. It is similar to
+// golang.org/x/sync/semaphore, but with this package's timeout-based acquisition.
+// A request for more weight than the whole budget fails immediately with
+// ErrTooManyTickets instead of blocking forever.
+type WeightedSemaphore struct {
+	sem *Semaphore
+	max int64
+}
+
+// NewWeighted constructs a new WeightedSemaphore with the given total weight
+// budget and timeout. The budget is capped at the largest int on the platform.
+func NewWeighted(maxWeight int64, timeout time.Duration) *WeightedSemaphore {
+	if maxWeight > maxInt {
+		maxWeight = maxInt
+	}
+	return &WeightedSemaphore{
+		sem: New(int(maxWeight), timeout),
+		max: maxWeight,
+	}
+}
+
+// Acquire tries to acquire w units of weight from the semaphore, waiting up to
+// the timeout for them. It acquires either all of them, returning nil, or none of
+// them, returning an error wrapping ErrNoTickets. If w exceeds the semaphore's
+// total budget it returns ErrTooManyTickets without waiting. Acquiring a weight
+// of zero or less always succeeds. It is safe to call Acquire concurrently on a
+// single WeightedSemaphore.
+func (s *WeightedSemaphore) Acquire(w int64) error {
+	if w > s.max {
+		s.sem.recordRefusal()
+		return ErrTooManyTickets
+	}
+	return s.sem.AcquireN(int(w))
+}
+
+// AcquireContext tries to acquire w units of weight like Acquire, but also gives
+// up and returns ctx.Err() if the given context is done first. It is safe to
+// call AcquireContext concurrently on a single WeightedSemaphore.
+func (s *WeightedSemaphore) AcquireContext(ctx context.Context, w int64) error {
+	if w > s.max {
+		s.sem.recordRefusal()
+		return ErrTooManyTickets
+	}
+	if w <= 0 {
+		return nil
+	}
+	return s.sem.acquireContext(ctx, int(w), nil)
+}
+
+// TryAcquire tries to acquire w units of weight without waiting, reporting
+// whether it did so. It is safe to call TryAcquire concurrently on a single
+// WeightedSemaphore.
+func (s *WeightedSemaphore) TryAcquire(w int64) bool {
+	if w > s.max {
+		s.sem.recordRefusal()
+		return false
+	}
+	return s.sem.TryAcquireN(int(w))
+}
+
+// Release releases w units of acquired weight back to the semaphore. It panics if
+// that is more weight than is held. It is safe to call Release concurrently on
+// a single WeightedSemaphore.
+func (s *WeightedSemaphore) Release(w int64) {
+	if w <= 0 {
+		return
+	}
+	if w > s.max {
+		panic("semaphore: released more tickets than were held")
+	}
+	s.sem.ReleaseN(int(w))
+}
+
+// Max returns the total weight budget of the semaphore.
+func (s *WeightedSemaphore) Max() int64 {
+	return s.max
+}
+
+// InUse returns the weight currently held.
+func (s *WeightedSemaphore) InUse() int64 {
+	return int64(s.sem.InUse())
+}
+
+// Available returns the weight that could currently be acquired.
+func (s *WeightedSemaphore) Available() int64 {
+	return int64(s.sem.Available())
+}
@@ -0,0 +1,109 @@
+package semaphore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWeightedSemaphore(t *testing.T) {
+	sem := NewWeighted(10, 20*time.Millisecond)
+
+	if err := sem.Acquire(7); err != nil {
+		t.Error(err)
+	}
+	if sem.InUse() != 7 || sem.Available() != 3 || sem.Max() != 10 {
+		t.Error(sem.InUse(), sem.Available(), sem.Max())
+	}
+	if err := sem.Acquire(4); !errors.Is(err, ErrNoTickets) {
+		t.Error(err)
+	}
+	if sem.TryAcquire(4) {
+		t.Error("weight should not be available")
+	}
+	if !sem.TryAcquire(3) {
+		t.Error("weight should be available")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	if err := sem.AcquireContext(ctx, 1); err != context.DeadlineExceeded {
+		t.Error(err)
+	}
+
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		sem.Release(10)
+	}()
+	if err := sem.AcquireContext(context.Background(), 10); err != nil {
+		t.Error(err)
+	}
+	sem.Release(10)
+	if sem.InUse() != 0 {
+		t.Error("all weight should have been released")
+	}
+}
+
+func TestWeightedSemaphoreTooHeavy(t *testing.T) {
+	// a request larger than the whole budget could never be satisfied, so it
+	// must fail straight away rather than waiting forever
+	sem := NewWeighted(10, -1)
+
+	done := make(chan error, 3)
+	go func() {
+		done <- sem.Acquire(11)
+		done <- sem.AcquireContext(context.Background(), 1<<62)
+	}()
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-done:
+			if err != ErrTooManyTickets {
+				t.Error(err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("oversized acquire blocked")
+		}
+	}
+	if sem.TryAcquire(11) {
+		t.Error("oversized TryAcquire should fail")
+	}
+	if refused := sem.sem.CountersSnapshot(false).Refused; refused != 3 {
+		t.Error("oversized requests should count as refused, got", refused)
+	}
+	if err := sem.Acquire(10); err != nil {
+		t.Error("a request for exactly the budget should succeed, got", err)
+	}
+	sem.Release(10)
+
+	defer func() {
+		if recover() == nil {
+			t.Error("over-release should panic")
+		}
+	}()
+	sem.Release(11)
+}
+
+func TestWeightedSemaphoreTracer(t *testing.T) {
+	tracer := &recordingTracer{}
+	sem := NewWeighted(10, 10*time.Millisecond)
+	sem.sem.tracer = tracer
+
+	if err := sem.AcquireContext(context.Background(), 10); err != nil {
+		t.Error(err)
+	}
+	if err := sem.AcquireContext(context.Background(), 1); !errors.Is(err, ErrNoTickets) {
+		t.Error(err)
+	}
+	sem.Release(10)
+
+	expected := []string{OutcomeAcquired, OutcomeTimeout}
+	if len(tracer.outcomes) != len(expected) {
+		t.Fatal(tracer.outcomes)
+	}
+	for i := range expected {
+		if tracer.outcomes[i] != expected[i] {
+			t.Errorf("outcome %d: expected %s, got %s", i, expected[i], tracer.outcomes[i])
+		}
+	}
+}